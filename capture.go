@@ -0,0 +1,52 @@
+package jupyter
+
+import (
+	"errors"
+	"os"
+)
+
+// stdioCapture holds the pipes that receive the standard output and error of the process while
+// it is being captured.
+type stdioCapture struct {
+	// stdout and stderr are the read ends of the pipes.
+	stdout *os.File
+	stderr *os.File
+
+	// stdoutW and stderrW are the write ends of the pipes. They are closed by restore.
+	stdoutW *os.File
+	stderrW *os.File
+
+	// origStdout and origStderr are the original standard output and error, which receive the
+	// output that is not published. They must not be used after restore.
+	origStdout *os.File
+	origStderr *os.File
+
+	// restore reinstates the original standard output and error and closes the write ends of
+	// the pipes, so that readers see EOF once all pending output is consumed.
+	restore func() error
+}
+
+// Restore ends the capture. The read ends remain open until Close.
+func (c *stdioCapture) Restore() error {
+	return c.restore()
+}
+
+// Close closes the read ends of the pipes.
+func (c *stdioCapture) Close() error {
+	return errors.Join(c.stdout.Close(), c.stderr.Close())
+}
+
+// newStdioPipes creates the pipes for a stdioCapture. On error nothing is left open.
+func newStdioPipes() (rOut, wOut, rErr, wErr *os.File, err error) {
+	rOut, wOut, err = os.Pipe()
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	rErr, wErr, err = os.Pipe()
+	if err != nil {
+		rOut.Close()
+		wOut.Close()
+		return nil, nil, nil, nil, err
+	}
+	return rOut, wOut, rErr, wErr, nil
+}
@@ -0,0 +1,104 @@
+//go:build linux
+
+package jupyter
+
+import (
+	"errors"
+	"log"
+	"log/slog"
+	"os"
+	"sync"
+	"syscall"
+)
+
+var (
+	// logStderr is a duplicate of the original standard error, which keeps receiving the
+	// kernel's own log output while file descriptor 2 is redirected.
+	logStderr     *os.File
+	logStderrOnce sync.Once
+)
+
+// keepLogOnStderr points the standard logger, which slog.Default writes to, at a duplicate of the
+// original standard error, unless it was configured to write somewhere else. Errors are logged to
+// `logger`.
+func keepLogOnStderr(logger *slog.Logger) {
+	logStderrOnce.Do(func() {
+		fd, err := syscall.Dup(syscall.Stderr)
+		if err != nil {
+			logger.Error("duplicating stderr for logging", "err", err)
+			return
+		}
+		syscall.CloseOnExec(fd)
+		logStderr = os.NewFile(uintptr(fd), "/dev/stderr")
+		if log.Writer() == os.Stderr {
+			log.SetOutput(logStderr)
+		}
+	})
+}
+
+// captureStdio redirects file descriptors 1 and 2 of the process into pipes. Unlike swapping the
+// `os.Stdout` and `os.Stderr` variables this also captures the output of cgo libraries, child
+// processes inheriting the descriptors and code holding on to the original *os.File values.
+func captureStdio(logger *slog.Logger) (*stdioCapture, error) {
+	keepLogOnStderr(logger)
+
+	rOut, wOut, rErr, wErr, err := newStdioPipes()
+	if err != nil {
+		return nil, err
+	}
+	closePipes := func() {
+		rOut.Close()
+		wOut.Close()
+		rErr.Close()
+		wErr.Close()
+	}
+
+	savedOut, err := syscall.Dup(syscall.Stdout)
+	if err != nil {
+		closePipes()
+		return nil, err
+	}
+	savedErr, err := syscall.Dup(syscall.Stderr)
+	if err != nil {
+		syscall.Close(savedOut)
+		closePipes()
+		return nil, err
+	}
+	syscall.CloseOnExec(savedOut)
+	syscall.CloseOnExec(savedErr)
+	origOut := os.NewFile(uintptr(savedOut), "/dev/stdout")
+	origErr := os.NewFile(uintptr(savedErr), "/dev/stderr")
+
+	restore := func() error {
+		err := errors.Join(
+			syscall.Dup3(savedOut, syscall.Stdout, 0),
+			syscall.Dup3(savedErr, syscall.Stderr, 0),
+		)
+		origOut.Close()
+		origErr.Close()
+		return errors.Join(err, wOut.Close(), wErr.Close())
+	}
+
+	if err := syscall.Dup3(int(wOut.Fd()), syscall.Stdout, 0); err != nil {
+		restore()
+		rOut.Close()
+		rErr.Close()
+		return nil, err
+	}
+	if err := syscall.Dup3(int(wErr.Fd()), syscall.Stderr, 0); err != nil {
+		restore()
+		rOut.Close()
+		rErr.Close()
+		return nil, err
+	}
+
+	return &stdioCapture{
+		stdout:     rOut,
+		stderr:     rErr,
+		stdoutW:    wOut,
+		stderrW:    wErr,
+		origStdout: origOut,
+		origStderr: origErr,
+		restore:    restore,
+	}, nil
+}
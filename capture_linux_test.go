@@ -0,0 +1,45 @@
+//go:build linux
+
+package jupyter
+
+import (
+	"io"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// The *os.File values for file descriptors 1 and 2, which the kernel captures. Holding on to them
+// also keeps them from being finalized once os.Stdout and os.Stderr are replaced.
+var (
+	fdStdout = os.Stdout
+	fdStderr = os.Stderr
+)
+
+// testStdout returns the writer the test interpreter uses as standard output.
+func testStdout() io.Writer { return fdStdout }
+
+// testStderr returns the writer the test interpreter uses as standard error.
+func testStderr() io.Writer { return fdStderr }
+
+// preserveTestOutput points os.Stdout and os.Stderr at duplicates of the original streams, so that
+// the output of the testing package is not captured by the kernel.
+func preserveTestOutput() {
+	if fd, err := syscall.Dup(syscall.Stdout); err == nil {
+		os.Stdout = os.NewFile(uintptr(fd), "/dev/stdout")
+	}
+	if fd, err := syscall.Dup(syscall.Stderr); err == nil {
+		os.Stderr = os.NewFile(uintptr(fd), "/dev/stderr")
+	}
+}
+
+// TestCaptureFileDescriptor tests that the output of a child process inheriting file descriptor 1 is
+// published in a "stream" message.
+func TestCaptureFileDescriptor(t *testing.T) {
+	stdout, _ := testOutputStream(t, `exec("echo", "fd")`)
+
+	if len(stdout) != 1 || stdout[0] != "fd\n" {
+		t.Fatalf("\t%s Unexpected stream messages %q", failure, stdout)
+	}
+	t.Logf("\t%s Returned the expected messages on stdout.", success)
+}
@@ -0,0 +1,37 @@
+//go:build !linux
+
+package jupyter
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+)
+
+// captureStdio redirects the standard output and error of the process into pipes by swapping
+// the `os.Stdout` and `os.Stderr` variables. Output written to the underlying file descriptors
+// directly is not captured.
+func captureStdio(logger *slog.Logger) (*stdioCapture, error) {
+	rOut, wOut, rErr, wErr, err := newStdioPipes()
+	if err != nil {
+		return nil, err
+	}
+
+	oldStdout, oldStderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = wOut, wErr
+
+	restore := func() error {
+		os.Stdout, os.Stderr = oldStdout, oldStderr
+		return errors.Join(wOut.Close(), wErr.Close())
+	}
+
+	return &stdioCapture{
+		stdout:     rOut,
+		stderr:     rErr,
+		stdoutW:    wOut,
+		stderrW:    wErr,
+		origStdout: oldStdout,
+		origStderr: oldStderr,
+		restore:    restore,
+	}, nil
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package jupyter
+
+import (
+	"io"
+	"os"
+)
+
+// testStdout returns the writer the test interpreter uses as standard output.
+func testStdout() io.Writer { return os.Stdout }
+
+// testStderr returns the writer the test interpreter uses as standard error.
+func testStderr() io.Writer { return os.Stderr }
+
+// preserveTestOutput does nothing: the kernel captures os.Stdout and os.Stderr themselves.
+func preserveTestOutput() {}
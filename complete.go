@@ -1,5 +1,14 @@
 package jupyter
 
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
 type Completion struct {
 	class,
 	name,
@@ -11,36 +20,281 @@ type CompletionResponse struct {
 	completions []Completion
 }
 
-func handleCompleteRequest(ir Interpreter, receipt msgReceipt) error {
+// handleCompleteRequest sends a complete_reply with the completions of the kernel, for special
+// commands and paths, merged with those of the interpreter.
+func (kernel *Kernel) handleCompleteRequest(receipt msgReceipt) error {
 	// Extract the data from the request.
 	reqcontent := receipt.Msg.Content.(map[string]interface{})
 	code := reqcontent["code"].(string)
 	cursorPos := int(reqcontent["cursor_pos"].(float64))
 
-	// autocomplete the code at the cursor position
-	_, matches, _ := ir.CompleteWords(code, cursorPos)
+	runes := []rune(code)
+	if cursorPos < 0 || cursorPos > len(runes) {
+		cursorPos = len(runes)
+	}
+
+	start, matches, interpreter := kernel.complete(string(runes[:cursorPos]))
+	if interpreter {
+		// autocomplete the code at the cursor position
+		prefix, completions, _ := kernel.ir.CompleteWords(code, cursorPos)
+		start, matches = mergeCompletions(runes, start, matches, len([]rune(prefix)), completions)
+	}
+	if matches == nil {
+		matches = []string{}
+		start = cursorPos
+	}
+
+	return receipt.Reply("complete_reply", map[string]interface{}{
+		"matches":      matches,
+		"cursor_start": start,
+		"cursor_end":   cursorPos,
+		"metadata":     map[string]interface{}{},
+		"status":       "ok",
+	})
+}
+
+// mergeCompletions merges two lists of completions replacing the code from different offsets, in
+// code points. Completions starting later are extended with the code between the offsets.
+func mergeCompletions(code []rune, start1 int, matches1 []string, start2 int, matches2 []string) (int, []string) {
+	switch {
+	case len(matches2) == 0:
+		return start1, matches1
+	case len(matches1) == 0:
+		return start2, matches2
+	}
+
+	if start2 < start1 {
+		start1, matches1, start2, matches2 = start2, matches2, start1, matches1
+	}
+	gap := string(code[start1:start2])
+
+	seen := make(map[string]bool)
+	var merged []string
+	for _, m := range matches1 {
+		if !seen[m] {
+			seen[m] = true
+			merged = append(merged, m)
+		}
+	}
+	for _, m := range matches2 {
+		if m = gap + m; !seen[m] {
+			seen[m] = true
+			merged = append(merged, m)
+		}
+	}
+	return start1, merged
+}
+
+// complete returns the completions of the kernel for the code before the cursor, with the offset
+// in code points of the text they replace, and whether the interpreter should complete too.
+func (kernel *Kernel) complete(before string) (start int, matches []string, interpreter bool) {
+	syntax := kernel.syntax()
+	lexer := lexer{syntax: &syntax}
+
+	// lineStart is the offset of the current line in code points.
+	prev, line, lineStart := "", before, 0
+	if i := strings.LastIndexByte(before, '\n'); i >= 0 {
+		prev, line, lineStart = before[:i], before[i+1:], len([]rune(before[:i]))+1
+		for _, l := range strings.Split(prev, "\n") {
+			kernel.classifyLine(&lexer, l)
+		}
+	}
+	offset := func(byteIndex int) int {
+		return lineStart + len([]rune(line[:byteIndex]))
+	}
+
+	if lexer.atTopLevel() {
+		trimmed := strings.TrimLeftFunc(line, unicode.IsSpace)
+		indent := len(line) - len(trimmed)
+
+		switch {
+		case strings.HasPrefix(trimmed, "%") && kernel.opts.Magics:
+			cell := strings.HasPrefix(trimmed, "%%") && strings.TrimSpace(prev) == ""
+			s, m := kernel.completeMagicLine(trimmed, cell)
+			return offset(indent + s), m, false
+		case (strings.HasPrefix(trimmed, "$") || strings.HasPrefix(trimmed, "!")) && kernel.opts.ShellEscapes:
+			// `!`, unlike `!!`, may also start an expression of the interpreter
+			escape := len(shellEscape.FindString(trimmed))
+			s, m := kernel.completeShell(trimmed[escape:])
+			return offset(indent + escape + s), m, escape == 1 && trimmed[0] == '!'
+		}
+		if m := shellAssignmentPrefix.FindStringIndex(trimmed); m != nil && kernel.opts.ShellEscapes {
+			s, matches := kernel.completeShell(trimmed[m[1]:])
+			return offset(indent + m[1] + s), matches, true
+		}
+	}
 
-	// prepare the reply
-	content := make(map[string]interface{})
+	// complete paths in string literals started on the current line
+	lexer.scan(line)
+	if lexer.quote != nil && lexer.quoteStart >= 0 {
+		word := line[lexer.quoteStart:]
+		if looksLikePath(word) {
+			return offset(lexer.quoteStart), kernel.completePaths(word, false), true
+		}
+	}
+	return 0, nil, true
+}
 
-	content["ename"] = "ERROR"
-	content["evalue"] = "no completions found"
-	content["traceback"] = nil
-	content["status"] = "error"
+// shellAssignmentPrefix matches the beginning of a `name = !command` line up to the command.
+var shellAssignmentPrefix = regexp.MustCompile(`^[\pL_][\pL\pN_]*\s*=\s*!!?`)
 
-	if len(matches) == 0 {
-		content["ename"] = "ERROR"
-		content["evalue"] = "no completions found"
-		content["traceback"] = nil
-		content["status"] = "error"
+// completeMagicLine completes a line starting with `%`: the name of the magic, or its arguments.
+// It returns the byte offset in line of the completed word.
+func (kernel *Kernel) completeMagicLine(line string, cell bool) (int, []string) {
+	prefix := "%"
+	names := kernel.magics.LineMagics()
+	if cell {
+		prefix = "%%"
+		names = kernel.magics.CellMagics()
 	}
-	//else {
-	//	partialWord := interp.TailIdentifier(prefix)
-	//	content["cursor_start"] = float64(len(prefix) - len(partialWord))
-	//	content["cursor_end"] = float64(cursorPos)
-	//	content["matches"] = matches
-	//	content["status"] = "ok"
-	//}
 
-	return receipt.Reply("complete_reply", content)
+	name := line[len(prefix):]
+	if i := strings.IndexFunc(name, unicode.IsSpace); i >= 0 {
+		// complete the arguments
+		m, ok := kernel.magics.Lookup(name[:i])
+		if !ok {
+			return len(line), nil
+		}
+		wordStart := strings.LastIndexFunc(line, unicode.IsSpace) + 1
+		word := line[wordStart:]
+		if m.Complete != nil {
+			return wordStart, m.Complete(kernel, word)
+		}
+		return wordStart, CompletePaths(kernel, word)
+	}
+
+	matches := []string{}
+	for _, n := range names {
+		if strings.HasPrefix(n, name) {
+			matches = append(matches, prefix+n)
+		}
+	}
+	return 0, matches
+}
+
+// completeShell completes a shell command: the executable for the first word, paths for the next
+// ones. It returns the byte offset in command of the completed word. Nothing is completed if the
+// policy of the kernel forbids shell commands, and only allowed executables are completed.
+func (kernel *Kernel) completeShell(command string) (int, []string) {
+	wordStart := strings.LastIndexFunc(command, unicode.IsSpace) + 1
+	word := command[wordStart:]
+	policy := &kernel.opts.Policy
+	if policy.checkShell() != nil {
+		return wordStart, nil
+	}
+	if strings.TrimSpace(command[:wordStart]) == "" && !strings.ContainsRune(word, '/') {
+		var matches []string
+		for _, name := range completeExecutables(word) {
+			if policy.checkExecutable(kernel.dir, name) == nil {
+				matches = append(matches, name)
+			}
+		}
+		return wordStart, matches
+	}
+	return wordStart, CompletePaths(kernel, word)
+}
+
+// CompletePaths is a MagicCompleter completing paths relative to the working directory of the kernel.
+func CompletePaths(kernel *Kernel, word string) []string {
+	return kernel.completePaths(word, false)
+}
+
+// CompleteDirectories is a MagicCompleter completing paths of directories.
+func CompleteDirectories(kernel *Kernel, word string) []string {
+	return kernel.completePaths(word, true)
+}
+
+// completePaths returns the paths starting with `word` relative to the working directory of the
+// kernel, leaving out those outside of the root directory of its policy.
+func (kernel *Kernel) completePaths(word string, dirsOnly bool) []string {
+	return completePaths(kernel.dir, word, dirsOnly, kernel.opts.Policy.RootDir)
+}
+
+// CompleteNothing is a MagicCompleter for magics without arguments to complete.
+func CompleteNothing(kernel *Kernel, word string) []string {
+	return nil
+}
+
+// looksLikePath reports whether the contents of a string literal look like the beginning of a path.
+func looksLikePath(s string) bool {
+	return strings.ContainsRune(s, '/') || strings.HasPrefix(s, ".") || strings.HasPrefix(s, "~")
+}
+
+// completePaths returns the paths starting with `word`, relative to dir. Directories end with a
+// slash. Hidden files are only completed if word names them explicitly. If root is not empty,
+// paths outside of it are left out.
+func completePaths(dir, word string, dirsOnly bool, root string) []string {
+	dirPart, filePart := "", word
+	if i := strings.LastIndexByte(word, '/'); i >= 0 {
+		dirPart, filePart = word[:i+1], word[i+1:]
+	}
+
+	list := dirPart
+	if rest, ok := strings.CutPrefix(list, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			list = filepath.Join(home, rest)
+		}
+	}
+	if list == "" {
+		list = "."
+	}
+	if !filepath.IsAbs(list) {
+		list = filepath.Join(dir, list)
+	}
+
+	entries, err := os.ReadDir(list)
+	if err != nil {
+		return nil
+	}
+
+	var matches []string
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, filePart) || strings.HasPrefix(name, ".") && !strings.HasPrefix(filePart, ".") {
+			continue
+		}
+		if root != "" && !isWithin(root, filepath.Join(list, name)) {
+			continue
+		}
+		isDir := e.IsDir()
+		if e.Type()&os.ModeSymlink != 0 {
+			if info, err := os.Stat(filepath.Join(list, name)); err == nil {
+				isDir = info.IsDir()
+			}
+		}
+		switch {
+		case isDir:
+			matches = append(matches, dirPart+name+"/")
+		case !dirsOnly:
+			matches = append(matches, dirPart+name)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// completeExecutables returns the names of the executables in $PATH starting with prefix.
+func completeExecutables(prefix string) []string {
+	seen := make(map[string]bool)
+	var matches []string
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			name := e.Name()
+			if seen[name] || !strings.HasPrefix(name, prefix) {
+				continue
+			}
+			info, err := os.Stat(filepath.Join(dir, name))
+			if err != nil || info.IsDir() || info.Mode()&0o111 == 0 {
+				continue
+			}
+			seen[name] = true
+			matches = append(matches, name)
+		}
+	}
+	sort.Strings(matches)
+	return matches
 }
@@ -0,0 +1,120 @@
+package jupyter
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestKernelCompletion tests the completion of magics, shell commands and paths.
+func TestKernelCompletion(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"script.go", ".hidden", "sub/inner.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	env := []string{"JUPYTER_COMPLETION_VAR=1"}
+
+	kernel := &Kernel{ir: testInterpreter{}, opts: defaultKernelOptions(), dir: dir, env: env, magics: NewMagicRegistry()}
+	kernel.registerBuiltinMagics()
+
+	tests := []struct {
+		before      string
+		start       int
+		want        []string
+		interpreter bool
+	}{
+		{"%cd s", 4, []string{"sub/"}, false},
+		{"%run s", 5, []string{"script.go", "sub/"}, false},
+		{"%run sub/", 5, []string{"sub/inner.txt"}, false},
+		{"%run .h", 5, []string{".hidden"}, false},
+		{"%env JUPYTER_COMPLETION_", 5, []string{"JUPYTER_COMPLETION_VAR"}, false},
+		{"%lsmagic x", 9, nil, false},
+		{"x := 1\n$ls s", 11, []string{"script.go", "sub/"}, false},
+		{"files = !ls su", 12, []string{"sub/"}, true},
+		{"!!ls su", 5, []string{"sub/"}, false},
+		{"\tf(\"./s", 4, []string{"./script.go", "./sub/"}, true},
+		{"s := `sub/\n` + \"sub/i", 16, []string{"sub/inner.txt"}, true},
+		{`x := "plain`, 0, nil, true},
+	}
+
+	for _, test := range tests {
+		start, matches, interpreter := kernel.complete(test.before)
+		if start != test.start || !reflect.DeepEqual(matches, test.want) || interpreter != test.interpreter {
+			t.Fatalf("\t%s complete(%q) = %d, %q, %v, want %d, %q, %v", failure, test.before,
+				start, matches, interpreter, test.start, test.want, test.interpreter)
+		}
+	}
+
+	if _, matches, _ := kernel.complete("$ech"); !containsString(matches, "echo") {
+		t.Fatalf("\t%s Expected echo among the executables but got %q", failure, matches)
+	}
+	t.Logf("\t%s Special commands and paths were completed.", success)
+}
+
+// TestCompletionPolicy tests that completion leaves out the paths outside of the root directory and the
+// executables the policy forbids.
+func TestCompletionPolicy(t *testing.T) {
+	dir, bin := t.TempDir(), t.TempDir()
+	for _, name := range []string{"root", "outside"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"tool-allowed", "tool-denied"} {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte("#!/bin/sh\n"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin)
+
+	root := filepath.Join(dir, "root")
+	kernel := &Kernel{ir: testInterpreter{}, opts: defaultKernelOptions(), dir: root, magics: NewMagicRegistry()}
+	kernel.opts.Policy = Policy{RootDir: root, AllowedExecutables: []string{"tool-allowed"}}
+	kernel.registerBuiltinMagics()
+
+	tests := []struct {
+		before string
+		want   []string
+	}{
+		{"%cd ../", []string{"../root/"}},
+		{"$ls " + dir + "/", []string{dir + "/root/"}},
+		{"$tool-", []string{"tool-allowed"}},
+	}
+	for _, test := range tests {
+		if _, matches, _ := kernel.complete(test.before); !reflect.DeepEqual(matches, test.want) {
+			t.Fatalf("\t%s complete(%q) = %q, want %q", failure, test.before, matches, test.want)
+		}
+	}
+
+	kernel.opts.Policy.NoShell = true
+	if _, matches, _ := kernel.complete("$tool-"); len(matches) != 0 {
+		t.Fatalf("\t%s Expected no completions without shell commands but got %q", failure, matches)
+	}
+	t.Logf("\t%s Completion followed the policy.", success)
+}
+
+// TestMergeCompletions tests merging completions that replace code from different offsets.
+func TestMergeCompletions(t *testing.T) {
+	code := []rune("fmt.Pr")
+	start, matches := mergeCompletions(code, 4, []string{"Println", "Printf"}, 0, []string{"fmt.Println", "fmt.Print"})
+	if start != 0 || !reflect.DeepEqual(matches, []string{"fmt.Println", "fmt.Print", "fmt.Printf"}) {
+		t.Fatalf("\t%s Unexpected merge %d %q", failure, start, matches)
+	}
+	t.Logf("\t%s Completions were merged.", success)
+}
+
+// containsString reports whether list contains s.
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package jupyter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+)
+
+// ExecutionContext describes a single execute_request to an Evaluator.
+type ExecutionContext struct {
+	// Context is cancelled once the execution is over or aborted.
+	Context context.Context
+
+	// ExecCount is the execution counter of the cell.
+	ExecCount int
+
+	// Silent is set when the front-end asked for the code to be run without broadcasting output
+	// or incrementing the execution counter.
+	Silent bool
+
+	// StoreHistory is set when the code should be recorded in the execution history.
+	StoreHistory bool
+
+	// Parent is the header of the execute_request message.
+	Parent MsgHeader
+
+	// Metadata is the metadata of the execute_request message.
+	Metadata map[string]interface{}
+
+	// Dir is the working directory of the kernel. It is changed with `%cd` and is independent
+	// of the working directory of the process.
+	Dir string
+
+	// Env is the environment of the kernel as NAME=value pairs, in which shell commands run. It is
+	// changed with `%env` and is independent of the environment of the process.
+	Env []string
+
+	// CellID is the id of the notebook cell, as sent by JupyterLab in `metadata.cellId`.
+	// It is empty for front-ends that don't send it.
+	CellID string
+
+	// Stdout and Stderr write to the output streams of the cell.
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Display publishes data as a display_data message of the cell.
+	Display func(data Data) error
+
+	// Payload holds the payloads sent with the execute_reply, such as set_next_input.
+	Payload []map[string]interface{}
+
+	// input requests a line of input from the front-end. It is nil when the front-end does not
+	// allow stdin requests.
+	input inputFunc
+
+	// timeout cancels Context when the cell runs too long. It is nil outside of cells.
+	timeout *cellTimeout
+
+	// running holds the paths of the files being run by `%run`, innermost last.
+	running []string
+}
+
+// inputFunc requests a line of input from the front-end, waiting for the answer until ctx is done.
+type inputFunc func(ctx context.Context, prompt string, password bool) (string, error)
+
+// ErrStdinNotAllowed is returned by ExecutionContext.Input when the front-end does not accept
+// input requests for the cell.
+var ErrStdinNotAllowed = errors.New("the front-end does not accept input requests")
+
+// Evaluator may be implemented by an Interpreter to receive the ExecutionContext of the code it
+// evaluates. The kernel calls EvalContext instead of Interpreter.Eval when it is available.
+type Evaluator interface {
+	EvalContext(ctx *ExecutionContext, code string) (values []any, err error)
+}
+
+// Input asks the user for a line of input through the stdin channel of the front-end. If password
+// is set, the front-end hides the input.
+func (ctx *ExecutionContext) Input(prompt string, password bool) (string, error) {
+	if ctx.input == nil {
+		return "", ErrStdinNotAllowed
+	}
+	return ctx.input(ctx.Context, prompt, password)
+}
+
+// SetNextInput asks the front-end to put `text` into the next cell, or into the current cell if
+// `replace` is set.
+func (ctx *ExecutionContext) SetNextInput(text string, replace bool) {
+	ctx.Payload = append(ctx.Payload, map[string]interface{}{
+		"source":  "set_next_input",
+		"text":    text,
+		"replace": replace,
+	})
+}
+
+// resolvePath returns `path` relative to the working directory of the kernel.
+func (ctx *ExecutionContext) resolvePath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(ctx.Dir, path)
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package jupyter
+
+import (
+	"syscall"
+	"time"
+)
+
+// cpuTime returns the user and system CPU time consumed by the process so far.
+func cpuTime() (user, sys time.Duration, ok bool) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0, 0, false
+	}
+	return time.Duration(usage.Utime.Nano()), time.Duration(usage.Stime.Nano()), true
+}
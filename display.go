@@ -26,25 +26,119 @@ const (
 	MIMETypeText       = "text/plain"
 )
 
-/**
- * general interface, allows libraries to fully specify
- * how their data is displayed by Jupyter.
- * Supports multiple MIME formats.
- *
- * Note that Data defined above is an alias:
- * libraries can implement Renderer without importing gophernotes
- */
-
-// if vals[] contain a single non-nil value which is auto-renderable,
-// convert it to Data and return it.
-// otherwise return MakeData("text/plain", fmt.Sprint(vals...))
-func (kernel *Kernel) autoRenderResults(vals []any) Data {
+// Renderer is implemented by values that fully specify how they are displayed, in any number of
+// formats. Data is an alias of an unnamed struct type, so libraries can implement Renderer
+// without importing go-jupyter.
+type Renderer interface {
+	Render() Data
+}
+
+// SimpleRenderer is implemented by values displayed in several formats, without metadata.
+type SimpleRenderer interface {
+	SimpleRender() MIMEMap
+}
+
+// The following interfaces are implemented by values having a representation in a single format.
+// A value may implement several of them, and is then displayed with all its representations.
+type (
+	// HTMLer is implemented by values displayed as HTML.
+	HTMLer interface {
+		HTML() string
+	}
+
+	// JavaScripter is implemented by values displayed by running JavaScript in the front-end.
+	JavaScripter interface {
+		JavaScript() string
+	}
+
+	// JPEGer is implemented by values displayed as a JPEG image.
+	JPEGer interface {
+		JPEG() []byte
+	}
+
+	// JSONer is implemented by values displayed as JSON. The value returned by JSON must be
+	// serializable with encoding/json.
+	JSONer interface {
+		JSON() any
+	}
+
+	// Latexer is implemented by values displayed as LaTeX.
+	Latexer interface {
+		Latex() string
+	}
+
+	// Markdowner is implemented by values displayed as Markdown.
+	Markdowner interface {
+		Markdown() string
+	}
+
+	// PDFer is implemented by values displayed as a PDF document.
+	PDFer interface {
+		PDF() []byte
+	}
+
+	// PNGer is implemented by values displayed as a PNG image.
+	PNGer interface {
+		PNG() []byte
+	}
+
+	// SVGer is implemented by values displayed as an SVG image.
+	SVGer interface {
+		SVG() string
+	}
+)
+
+// publishResults publishes the values returned by a cell, in order: all but the last one as
+// display_data, and the last one as the execute_result of the cell. Nil values are skipped.
+//
+// The last value is accounted for first by the output limiter, so that the values displayed
+// before it cannot crowd it out. If it is suppressed anyway, a text/plain placeholder is
+// published as the result, since frontends expect one.
+func (kernel *Kernel) publishResults(receipt *msgReceipt, limiter *outputLimiter, execCount int, vals []any) {
+	var results []Data
 	for _, val := range vals {
-		if x, ok := val.(Data); ok {
-			return x
+		if val != nil {
+			results = append(results, kernel.renderResult(val))
 		}
 	}
-	return Data{}
+	if len(results) == 0 {
+		return
+	}
+
+	last := len(results) - 1
+	result := results[last]
+	if !limiter.reserveData(result) {
+		result = MakeData(MIMETypeText, suppressedResult)
+	}
+
+	for _, data := range results[:last] {
+		if !limiter.reserveData(data) {
+			continue
+		}
+		if err := receipt.PublishDisplayData(data); err != nil {
+			kernel.logger.Error("publishing display data", "err", err)
+		}
+	}
+	if err := receipt.PublishExecutionResult(execCount, result); err != nil {
+		kernel.logger.Error("publishing execution result", "err", err)
+	}
+}
+
+// suppressedResult replaces the text of a cell result suppressed by the output limits.
+const suppressedResult = "<result suppressed: output limit exceeded>"
+
+// renderResult renders a value returned by a cell: values that can be auto-rendered with all
+// their representations, tabular values as tables, and other values as pretty-printed text/plain.
+func (kernel *Kernel) renderResult(val any) Data {
+	if data, ok := kernel.autoRender("", val); ok {
+		return data
+	}
+	text := kernel.opts.Pretty.Format(val)
+	if data, ok := renderTable(val, kernel.opts.Tables); ok {
+		data.Data[MIMETypeText] = text
+		return data
+	}
+	return MakeData(MIMETypeText, text)
 }
 
 func anyToString(vals ...interface{}) string {
@@ -58,19 +152,77 @@ func anyToString(vals ...interface{}) string {
 	return buf.String()
 }
 
-// return true if data type should be auto-rendered graphically
-func (kernel *Kernel) canAutoRender(data interface{}) bool {
-	return true
+// autoRender renders arg with the external renderers of the kernel, then the renderer interfaces
+// it implements, with a text/plain fallback. It reports false if arg is rendered by neither.
+// Renderers that panic are skipped.
+// Data is returned unchanged. The kernel may be nil, to only use the renderer interfaces.
+func (kernel *Kernel) autoRender(mimeType string, arg interface{}) (Data, bool) {
+	if x, ok := arg.(Data); ok {
+		return x, true
+	}
+
+	var data Data
+	handled := false
+	if kernel != nil {
+		var complete bool
+		data, handled, complete = kernel.renderers.render(arg)
+		if complete {
+			return fillDefaults(data, arg, "", nil, mimeType, nil), true
+		}
+	}
+	if builtin, ok := safeRender(func() (Data, bool) { return renderInterfaces(arg) }); ok {
+		mergeData(&data, builtin, nil)
+		handled = true
+	}
+	if !handled {
+		return Data{}, false
+	}
+	return fillDefaults(data, arg, "", nil, mimeType, nil), true
 }
 
-// detect and render data types that should be auto-rendered graphically
-func (kernel *Kernel) autoRender(mimeType string, arg interface{}) Data {
-	// try Data
-	if x, ok := arg.(Data); ok {
-		return x
+// renderInterfaces returns the representations of arg given by the renderer interfaces it
+// implements. Render and SimpleRender come first; the representations of the single-format
+// interfaces are added to them.
+func renderInterfaces(arg interface{}) (Data, bool) {
+	var data Data
+	set := func(mimeType string, value interface{}) {
+		mergeData(&data, Data{Data: MIMEMap{mimeType: value}}, nil)
 	}
 
-	return Data{}
+	if x, ok := arg.(Renderer); ok {
+		mergeData(&data, x.Render(), nil)
+	}
+	if x, ok := arg.(SimpleRenderer); ok {
+		mergeData(&data, Data{Data: x.SimpleRender()}, nil)
+	}
+	if x, ok := arg.(HTMLer); ok {
+		set(MIMETypeHTML, x.HTML())
+	}
+	if x, ok := arg.(JavaScripter); ok {
+		set(MIMETypeJavaScript, x.JavaScript())
+	}
+	if x, ok := arg.(JPEGer); ok {
+		set(MIMETypeJPEG, x.JPEG())
+	}
+	if x, ok := arg.(JSONer); ok {
+		set(MIMETypeJSON, x.JSON())
+	}
+	if x, ok := arg.(Latexer); ok {
+		set(MIMETypeLatex, x.Latex())
+	}
+	if x, ok := arg.(Markdowner); ok {
+		set(MIMETypeMarkdown, x.Markdown())
+	}
+	if x, ok := arg.(PDFer); ok {
+		set(MIMETypePDF, x.PDF())
+	}
+	if x, ok := arg.(PNGer); ok {
+		set(MIMETypePNG, x.PNG())
+	}
+	if x, ok := arg.(SVGer); ok {
+		set(MIMETypeSVG, x.SVG())
+	}
+	return data, data.Data != nil
 }
 
 func fillDefaults(data Data, arg interface{}, s string, b []byte, mimeType string, err error) Data {
@@ -85,7 +237,7 @@ func fillDefaults(data Data, arg interface{}, s string, b []byte, mimeType strin
 		data.Data[mimeType] = s
 	}
 	// ensure plain text is set
-	if data.Data[MIMETypeText] == "" {
+	if text, _ := data.Data[MIMETypeText].(string); text == "" {
 		if len(s) == 0 {
 			s = fmt.Sprint(arg)
 		}
@@ -106,8 +258,8 @@ func fillDefaults(data Data, arg interface{}, s string, b []byte, mimeType strin
 // do our best to render data graphically
 func render(mimeType string, data interface{}) Data {
 	var kernel *Kernel // intentionally nil
-	if kernel.canAutoRender(data) {
-		return kernel.autoRender(mimeType, data)
+	if rendered, ok := kernel.autoRender(mimeType, data); ok {
+		return rendered
 	}
 	var s string
 	var b []byte
@@ -0,0 +1,205 @@
+package jupyter
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testPoint implements several single-format renderer interfaces.
+type testPoint struct{ X, Y int }
+
+func (p testPoint) HTML() string     { return "<b>point</b>" }
+func (p testPoint) Markdown() string { return "**point**" }
+func (p testPoint) JSON() any        { return map[string]int{"x": p.X, "y": p.Y} }
+func (p testPoint) Latex() string    { return "$(1, 2)$" }
+
+// testChart implements Renderer, and SVGer which adds to its representations.
+type testChart struct{}
+
+func (testChart) Render() Data {
+	return Data{Data: MIMEMap{MIMETypeHTML: "<div>chart</div>", MIMETypeText: "chart"}, Metadata: MIMEMap{"isolated": true}}
+}
+func (testChart) SVG() string  { return "<svg/>" }
+func (testChart) HTML() string { return "<p>ignored</p>" }
+
+// testPlain implements SimpleRenderer.
+type testPlain struct{}
+
+func (testPlain) SimpleRender() MIMEMap { return MIMEMap{MIMETypePNG: []byte{1, 2}} }
+func (testPlain) String() string        { return "plain" }
+
+// TestAutoRender tests that values implementing the renderer interfaces are rendered with all their
+// representations and a text/plain fallback.
+func TestAutoRender(t *testing.T) {
+	var kernel *Kernel
+
+	cases := []struct {
+		value    any
+		data     MIMEMap
+		metadata MIMEMap
+	}{
+		{testPoint{1, 2}, MIMEMap{
+			MIMETypeHTML:     "<b>point</b>",
+			MIMETypeMarkdown: "**point**",
+			MIMETypeJSON:     map[string]int{"x": 1, "y": 2},
+			MIMETypeLatex:    "$(1, 2)$",
+			MIMETypeText:     "{1 2}",
+		}, nil},
+		{testChart{}, MIMEMap{
+			MIMETypeHTML: "<div>chart</div>",
+			MIMETypeSVG:  "<svg/>",
+			MIMETypeText: "chart",
+		}, MIMEMap{"isolated": true}},
+		{testPlain{}, MIMEMap{
+			MIMETypePNG:  []byte{1, 2},
+			MIMETypeText: "plain",
+		}, nil},
+		{HTML("<i>x</i>"), MIMEMap{
+			MIMETypeHTML: "<i>x</i>",
+			MIMETypeText: "<i>x</i>",
+		}, nil},
+	}
+	for _, c := range cases {
+		data, ok := kernel.autoRender("", c.value)
+		if !ok {
+			t.Fatalf("\t%s Expected %T to be auto-rendered", failure, c.value)
+		}
+		if !reflect.DeepEqual(data.Data, c.data) || !reflect.DeepEqual(data.Metadata, c.metadata) {
+			t.Fatalf("\t%s Unexpected rendering of %T: %v %v", failure, c.value, data.Data, data.Metadata)
+		}
+	}
+
+	for _, value := range []any{"text", 42, []int{1}} {
+		if _, ok := kernel.autoRender("", value); ok {
+			t.Fatalf("\t%s Expected %T not to be auto-rendered", failure, value)
+		}
+	}
+
+	if data := Any(MIMETypeHTML, "<b>x</b>"); data.Data[MIMETypeHTML] != "<b>x</b>" || data.Data[MIMETypeText] != "<b>x</b>" {
+		t.Fatalf("\t%s Unexpected result of Any: %v", failure, data.Data)
+	}
+	t.Logf("\t%s Renderer interfaces were rendered.", success)
+}
+
+// testMatrix stands for a type of a third-party library.
+type testMatrix [][]float64
+
+// TestExternalRenderers tests that the external renderers of the kernel are used by type, by function
+// and by priority, and may override some representations of the renderer interfaces.
+func TestExternalRenderers(t *testing.T) {
+	kernel := &Kernel{renderers: NewRendererRegistry()}
+
+	kernel.Renderers().RegisterType(reflect.TypeOf(testMatrix{}), func(value any) Data {
+		return MakeData(MIMETypeLatex, "\\begin{matrix}\\end{matrix}")
+	})
+	kernel.RegisterRenderer(ExternalRenderer{
+		Type:      reflect.TypeOf((*HTMLer)(nil)).Elem(),
+		Render:    func(value any) (Data, bool) { return HTML("<em>override</em>"), true },
+		Priority:  1,
+		MIMETypes: []string{MIMETypeHTML},
+	})
+	kernel.Renderers().RegisterFunc(func(value any) (Data, bool) {
+		n, ok := value.(int)
+		if !ok || n != 42 {
+			return Data{}, false
+		}
+		return Markdown("**42**"), true
+	})
+
+	cases := []struct {
+		value any
+		data  MIMEMap
+	}{
+		// A renderer of the type.
+		{testMatrix{{1}}, MIMEMap{
+			MIMETypeLatex: "\\begin{matrix}\\end{matrix}",
+			MIMETypeText:  "\\begin{matrix}\\end{matrix}",
+		}},
+		// A per-MIME override of an interface type, the other representations are kept.
+		{testPoint{1, 2}, MIMEMap{
+			MIMETypeHTML:     "<em>override</em>",
+			MIMETypeMarkdown: "**point**",
+			MIMETypeJSON:     map[string]int{"x": 1, "y": 2},
+			MIMETypeLatex:    "$(1, 2)$",
+			MIMETypeText:     "{1 2}",
+		}},
+		// A function deciding which values it renders.
+		{42, MIMEMap{
+			MIMETypeMarkdown: "**42**",
+			MIMETypeText:     "**42**",
+		}},
+	}
+	for _, c := range cases {
+		data, ok := kernel.autoRender("", c.value)
+		if !ok || !reflect.DeepEqual(data.Data, c.data) {
+			t.Fatalf("\t%s Unexpected rendering of %v: %v", failure, c.value, data.Data)
+		}
+	}
+	if _, ok := kernel.autoRender("", 41); ok {
+		t.Fatalf("\t%s Expected 41 not to be rendered", failure)
+	}
+
+	// Renderers of higher priority come first.
+	kernel.RegisterRenderer(ExternalRenderer{
+		Type:     reflect.TypeOf(testMatrix{}),
+		Render:   func(value any) (Data, bool) { return SVG("<svg/>"), true },
+		Priority: 2,
+	})
+	if data, _ := kernel.autoRender("", testMatrix{}); data.Data[MIMETypeSVG] != "<svg/>" || data.Data[MIMETypeLatex] != nil {
+		t.Fatalf("\t%s Unexpected rendering by priority: %v", failure, data.Data)
+	}
+	kernel.Renderers().Unregister(reflect.TypeOf(testMatrix{}))
+	if _, ok := kernel.autoRender("", testMatrix{}); ok {
+		t.Fatalf("\t%s Expected the renderers of testMatrix to be removed", failure)
+	}
+	t.Logf("\t%s External renderers were used.", success)
+}
+
+// testPanicky implements Renderer with a Render method that panics.
+type testPanicky struct{ N int }
+
+func (testPanicky) Render() Data { panic("render failed") }
+
+// TestRenderPanics tests that renderers that panic are skipped, and the value falls back to its
+// text/plain rendering.
+func TestRenderPanics(t *testing.T) {
+	kernel := &Kernel{renderers: NewRendererRegistry(), opts: defaultKernelOptions()}
+	kernel.RegisterRenderer(ExternalRenderer{
+		Type:   reflect.TypeOf(testMatrix{}),
+		Render: func(value any) (Data, bool) { panic("render failed") },
+	})
+
+	if data := kernel.renderResult(testPanicky{1}); data.Data[MIMETypeText] != kernel.opts.Pretty.Format(testPanicky{1}) {
+		t.Fatalf("\t%s Unexpected rendering of a panicking Render method: %v", failure, data.Data)
+	}
+	if data := kernel.renderResult(testMatrix{{1}}); data.Data[MIMETypeText] != kernel.opts.Pretty.Format(testMatrix{{1}}) {
+		t.Fatalf("\t%s Unexpected rendering of a panicking external renderer: %v", failure, data.Data)
+	}
+	t.Logf("\t%s Renderers that panic fell back to text/plain.", success)
+}
+
+// TestPublishResults tests that all values of a cell are published, the last one as its result.
+func TestPublishResults(t *testing.T) {
+	_, client := startTestKernel(t)
+
+	content, pub := client.executeCode(t, `value("a")`+"\n"+`ctxprint("out\n")`+"\n"+`value("b")`+"\n"+`repeat(2, value("c"))`)
+	count, _ := content["execution_count"].(float64)
+	expected := []string{"display_data a", "display_data b", "display_data c", "execute_result c"}
+	if results := testResults(t, pub); !reflect.DeepEqual(results, expected) {
+		t.Fatalf("\t%s Unexpected results %q, expected %q", failure, results, expected)
+	}
+	for _, pubMsg := range pub {
+		if pubMsg.Header.MsgType == "execute_result" {
+			content := getMsgContentAsJSONObject(t, pubMsg)
+			if n, _ := content["execution_count"].(float64); n != count {
+				t.Fatalf("\t%s Unexpected execution count %v of the result", failure, n)
+			}
+		}
+	}
+
+	stdout, _ := testOutputStreamFor(t, client, `value("plain")`)
+	if len(stdout) != 0 {
+		t.Fatalf("\t%s Unexpected output %q of a plain value", failure, stdout)
+	}
+	t.Logf("\t%s All values were published.", success)
+}
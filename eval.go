@@ -1,8 +1,10 @@
 package jupyter
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"strings"
 )
 
 type Interpreter interface {
@@ -12,9 +14,39 @@ type Interpreter interface {
 
 type ReturnValue any
 
-// doEval evaluates the code in the interpreter. This function captures an uncaught panic
-// as well as the values of the last statement/expression.
-func doEval(ir Interpreter, outerr OutErr, code string) (val []any, err error) {
+// runCell evaluates a cell with the execution hooks of the kernel around it.
+func (kernel *Kernel) runCell(ec *ExecutionContext, code string) ([]any, error) {
+	info := CellInfo{
+		Code:         code,
+		ExecCount:    ec.ExecCount,
+		Silent:       ec.Silent,
+		StoreHistory: ec.StoreHistory,
+		CellID:       ec.CellID,
+	}
+
+	result := CellResult{}
+	err := kernel.events.firePre(&info)
+	result.Info = info
+
+	switch {
+	case err == nil:
+		result.Values, result.Err = kernel.doEval(ec, info.Code)
+	case errors.Is(err, ErrSkipCell):
+		result.Skipped = true
+	default:
+		result.Err = err
+	}
+
+	if err := kernel.events.firePost(&result); err != nil {
+		kernel.logger.Error("running post-execution hooks", "err", err)
+	}
+
+	return result.Values, result.Err
+}
+
+// doEval runs the special commands of the cell and evaluates the rest of the code in the interpreter.
+// This function captures an uncaught panic as well as the values returned by the cell.
+func (kernel *Kernel) doEval(ec *ExecutionContext, code string) (val []any, err error) {
 
 	// Capture a panic from the evaluation if one occurs and store it in the `err` return parameter.
 	defer func() {
@@ -26,17 +58,57 @@ func doEval(ir Interpreter, outerr OutErr, code string) (val []any, err error) {
 		}
 	}()
 
-	code = evalSpecialCommands(outerr, code)
+	results, err := kernel.evalCode(ec, code)
+	if err != nil && ec.Context != nil {
+		// Report a timeout rather than its consequence, such as a killed shell command.
+		if cause := context.Cause(ec.Context); errors.Is(cause, ErrCellTimeout) {
+			err = cause
+		}
+	}
+	return results, err
+}
+
+// evalCode runs the special commands of code and evaluates the rest in the interpreter, in the
+// order they appear. A cell starting with a `%%` line is handed to the cell magic as a whole.
+func (kernel *Kernel) evalCode(ec *ExecutionContext, code string) ([]any, error) {
+	if kernel.opts.Magics {
+		if line, body, ok := cutCellMagic(code); ok {
+			return kernel.evalCellMagic(ec, line, body)
+		}
+	}
 
-	// Evaluate the code.
-	results, err := ir.Eval(code)
-	if results != nil {
-		for _, result := range results {
-			if _, ok := result.(Data); ok {
+	var results []any
+	for _, seg := range kernel.splitSpecialCommands(code) {
+		var (
+			values []any
+			err    error
+		)
+		switch seg.kind {
+		case segmentCode:
+			if strings.TrimSpace(seg.text) == "" {
 				continue
 			}
-			fmt.Println(result)
+			// Keep the line numbers of the cell in the errors of the interpreter.
+			values, err = kernel.eval(ec, strings.Repeat("\n", seg.line)+seg.text)
+		case segmentMagic:
+			values, err = kernel.evalLineMagic(ec, seg.text)
+		case segmentShell:
+			err = kernel.evalShellCommand(ec, seg.text)
+		case segmentShellAssignment:
+			err = kernel.evalShellAssignment(ec, seg.text)
+		}
+		results = append(results, values...)
+		if err != nil {
+			return results, err
 		}
 	}
-	return results, err
+	return results, nil
+}
+
+// eval evaluates code in the interpreter, through Evaluator if the interpreter implements it.
+func (kernel *Kernel) eval(ec *ExecutionContext, code string) ([]any, error) {
+	if ev, ok := kernel.ir.(Evaluator); ok {
+		return ev.EvalContext(ec, code)
+	}
+	return kernel.ir.Eval(code)
 }
@@ -0,0 +1,138 @@
+package jupyter
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrSkipCell may be returned by a pre-execution hook to skip the cell. Unlike other errors it is
+// not reported to the front-end.
+var ErrSkipCell = errors.New("cell skipped")
+
+// CellInfo describes a cell that is about to be executed. Pre-execution hooks may change Code to
+// rewrite what gets evaluated.
+type CellInfo struct {
+	Code         string
+	ExecCount    int
+	Silent       bool
+	StoreHistory bool
+	CellID       string
+}
+
+// CellResult describes the outcome of executing a cell.
+type CellResult struct {
+	// Info describes the cell, with the code as it was evaluated.
+	Info CellInfo
+
+	// Values are the values returned by the interpreter.
+	Values []any
+
+	// Err is the error of the execution, or the error returned by a pre-execution hook.
+	Err error
+
+	// Skipped is set when a pre-execution hook returned ErrSkipCell.
+	Skipped bool
+}
+
+// PreExecuteFunc is called before a cell is executed. Returning an error prevents the execution:
+// ErrSkipCell skips the cell silently, any other error is reported as the error of the cell.
+type PreExecuteFunc func(info *CellInfo) error
+
+// PostExecuteFunc is called after a cell was executed, or skipped.
+type PostExecuteFunc func(result *CellResult)
+
+// Events holds the execution hooks of a Kernel, modeled after the events of IPython. The pre_execute
+// and post_execute hooks run for every execution, including silent ones; the pre_run_cell and
+// post_run_cell hooks only for cells run by the user. As in IPython, pre_execute hooks run before
+// pre_run_cell hooks and post_execute hooks before post_run_cell hooks; hooks of the same event are
+// called in registration order.
+type Events struct {
+	mu          sync.Mutex
+	preExecute  []PreExecuteFunc
+	preRunCell  []PreExecuteFunc
+	postRunCell []PostExecuteFunc
+	postExecute []PostExecuteFunc
+}
+
+// OnPreExecute registers a hook called before every execution.
+func (e *Events) OnPreExecute(fn PreExecuteFunc) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.preExecute = append(e.preExecute, fn)
+}
+
+// OnPreRunCell registers a hook called before every cell that is not silent.
+func (e *Events) OnPreRunCell(fn PreExecuteFunc) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.preRunCell = append(e.preRunCell, fn)
+}
+
+// OnPostRunCell registers a hook called after every cell that is not silent.
+func (e *Events) OnPostRunCell(fn PostExecuteFunc) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.postRunCell = append(e.postRunCell, fn)
+}
+
+// OnPostExecute registers a hook called after every execution.
+func (e *Events) OnPostExecute(fn PostExecuteFunc) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.postExecute = append(e.postExecute, fn)
+}
+
+// firePre calls the pre-execution hooks of `info`, stopping at the first error.
+func (e *Events) firePre(info *CellInfo) error {
+	e.mu.Lock()
+	hooks := append([]PreExecuteFunc(nil), e.preExecute...)
+	if !info.Silent {
+		hooks = append(hooks, e.preRunCell...)
+	}
+	e.mu.Unlock()
+
+	for _, hook := range hooks {
+		if err := callPreHook(hook, info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// firePost calls the post-execution hooks of `result`.
+func (e *Events) firePost(result *CellResult) error {
+	e.mu.Lock()
+	hooks := append([]PostExecuteFunc(nil), e.postExecute...)
+	if !result.Info.Silent {
+		hooks = append(hooks, e.postRunCell...)
+	}
+	e.mu.Unlock()
+
+	var errs []error
+	for _, hook := range hooks {
+		errs = append(errs, callPostHook(hook, result))
+	}
+	return errors.Join(errs...)
+}
+
+// callPreHook calls `hook`, turning a panic into an error.
+func callPreHook(hook PreExecuteFunc, info *CellInfo) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("pre-execution hook panicked: %v", r)
+		}
+	}()
+	return hook(info)
+}
+
+// callPostHook calls `hook`, turning a panic into an error.
+func callPostHook(hook PostExecuteFunc, result *CellResult) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("post-execution hook panicked: %v", r)
+		}
+	}()
+	hook(result)
+	return nil
+}
@@ -2,12 +2,13 @@ package jupyter
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"io"
 	"log"
+	"log/slog"
 	"os"
-	"os/exec"
-	"strings"
+	"path/filepath"
+	"runtime/debug"
 	"sync"
 	"time"
 
@@ -17,7 +18,11 @@ import (
 // ProtocolVersion defines the Jupyter protocol version.
 const ProtocolVersion string = "5.0"
 
-// ExecCounter is incremented each time we run user code in the notebook.
+// ExecCounter is the execution counter of the kernel while a single kernel runs in the process.
+// It is not updated while several kernels run.
+//
+// Deprecated: every Kernel keeps its own execution counter, which is passed to interpreters in
+// ExecutionContext.ExecCount.
 var ExecCounter int
 
 // ConnectionInfo stores the contents of the kernel connection
@@ -89,6 +94,10 @@ type isCompleteReply struct {
 	Indent string `json:"indent"`
 }
 
+// captureDrainTimeout is how long the kernel waits for captured output to be forwarded before it
+// moves on, for example to publish the result of a cell.
+const captureDrainTimeout = time.Second
+
 const (
 	kernelStarting = "starting"
 	kernelBusy     = "busy"
@@ -102,30 +111,158 @@ func (s *Socket) RunWithSocket(run func(socket zmq4.Socket) error) error {
 	return run(s.Socket)
 }
 
+// Kernel serves the Jupyter messaging protocol for an Interpreter. All state of a kernel, such as
+// its execution counter and working directory, is kept on the Kernel value, so several kernels can
+// run in the same process. The standard output and error of the process are published under the
+// cell that started last only while a single kernel exists; with several kernels they go to the
+// original standard output and error, and the notebook gets a warning. Interpreters that may run
+// in several kernels of a process must write to ExecutionContext.Stdout and
+// ExecutionContext.Stderr, also for the output of child processes.
 type Kernel struct {
-	ir   Interpreter
-	info KernelInfo
+	ir      Interpreter
+	info    KernelInfo
+	opts    KernelOptions
+	logger  *slog.Logger
+	output  *outputRouter
+	sockets SocketGroup
+
+	// execCounter is incremented each time we run user code in the notebook.
+	execCounter int
+
+	// dir is the working directory of the kernel, used by shell commands and `%cd`.
+	dir string
+
+	// env is the environment of the kernel, used by shell commands and `%env`. It starts as a copy
+	// of the environment of the process.
+	env []string
+
+	events Events
+	magics *MagicRegistry
+
+	renderers *RendererRegistry
+
+	// inputReplies receives the input_reply messages of the stdin channel.
+	inputReplies chan ComposedMsg
+
+	shutdown  bool
+	closed    chan struct{}
+	closeOnce sync.Once
 }
 
-func RunKernel(ir Interpreter, connInfo ConnectionInfo, ki KernelInfo) {
+// NewKernel creates a kernel evaluating code with `ir` and binds the sockets described by `connInfo`.
+// Call Run to serve requests and Close to release the sockets. While another kernel exists in the
+// process, the standard output and error of the process are no longer published; see Kernel.
+func NewKernel(ir Interpreter, connInfo ConnectionInfo, ki KernelInfo, options ...Option) (*Kernel, error) {
+	opts := defaultKernelOptions()
+	for _, option := range options {
+		option(&opts)
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	if opts.HeartbeatTimeout <= 0 {
+		opts.HeartbeatTimeout = defaultKernelOptions().HeartbeatTimeout
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	if opts.MemoryLimit > 0 {
+		// The limit belongs to the Go runtime: the kernel created last sets it for all kernels of
+		// the process.
+		debug.SetMemoryLimit(opts.MemoryLimit)
+	}
 
-	// Create a new interpreter for evaluating notebook code.
-	// Throw out the error/warning messages that gomacro outputs writes to these streams.
-	//ir.Comp.Stdout = io.Discard
-	//ir.Comp.Stderr = io.Discard
+	if opts.Policy.RootDir != "" {
+		if opts.Policy.RootDir, err = filepath.Abs(opts.Policy.RootDir); err != nil {
+			return nil, err
+		}
+		if !isWithin(opts.Policy.RootDir, dir) {
+			dir = opts.Policy.RootDir
+		}
+	}
 
 	// Set up the ZMQ sockets through which the kernel will communicate.
 	sockets, err := prepareSockets(connInfo)
+	if err != nil {
+		closeSockets(sockets)
+		return nil, err
+	}
+
+	// Forward the standard output and error of the process to the notebook for as long as the kernel exists.
+	output, err := acquireOutputRouter(opts.Logger)
+	if err != nil {
+		closeSockets(sockets)
+		return nil, err
+	}
+
+	kernel := &Kernel{
+		ir:        ir,
+		info:      ki,
+		opts:      opts,
+		logger:    opts.Logger,
+		output:    output,
+		sockets:   sockets,
+		dir:       dir,
+		env:       os.Environ(),
+		magics:    NewMagicRegistry(),
+		renderers: NewRendererRegistry(),
+		closed:    make(chan struct{}),
+
+		inputReplies: make(chan ComposedMsg, 1),
+	}
+	kernel.registerBuiltinMagics()
+
+	return kernel, nil
+}
+
+// RunKernel runs a kernel for `ir` until it receives a shutdown request, then exits the process.
+func RunKernel(ir Interpreter, connInfo ConnectionInfo, ki KernelInfo, options ...Option) {
+	kernel, err := NewKernel(ir, connInfo, ki, options...)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// TODO connect all channel handlers to a WaitGroup to ensure shutdown before returning from runKernel.
+	err = kernel.Run()
+	kernel.Close()
+	if err != nil {
+		kernel.logger.Error("kernel stopped", "err", err)
+		os.Exit(1)
+	}
+
+	kernel.logger.Info("shutting down in response to shutdown_request")
+	os.Exit(0)
+}
+
+// Magics returns the registry of magic commands of the kernel.
+func (kernel *Kernel) Magics() *MagicRegistry {
+	return kernel.magics
+}
+
+// Events returns the execution hooks of the kernel.
+func (kernel *Kernel) Events() *Events {
+	return &kernel.events
+}
+
+// Options returns the options the kernel was created with.
+func (kernel *Kernel) Options() KernelOptions {
+	return kernel.opts
+}
+
+// Run serves requests until the kernel receives a shutdown request or is closed.
+func (kernel *Kernel) Run() error {
+	sockets := kernel.sockets
+
+	// TODO connect all channel handlers to a WaitGroup to ensure shutdown before returning from Run.
 
 	// Start up the heartbeat handler.
-	startHeartbeat(sockets.HBSocket, &sync.WaitGroup{})
+	heartbeat := kernel.startHeartbeat(&sync.WaitGroup{})
+	defer close(heartbeat)
 
-	// TODO gracefully shutdown the heartbeat handler on kernel shutdown by closing the chan returned by startHeartbeat.
+	if hook := kernel.opts.Hooks.OnStart; hook != nil {
+		hook(kernel)
+	}
 
 	type msgType struct {
 		Msg zmq4.Msg
@@ -156,48 +293,69 @@ func RunKernel(ir Interpreter, connInfo ConnectionInfo, ki KernelInfo) {
 	go poll(stdin, sockets.StdinSocket.Socket)
 	go poll(ctl, sockets.ControlSocket.Socket)
 
-	kernel := Kernel{
-		ir,
-		ki,
-	}
+	// Replies on the stdin channel arrive while a cell is executing, so they are handled apart
+	// from the shell messages.
+	go func() {
+		for v := range stdin {
+			kernel.handleStdinMsg(v.Msg, v.Err)
+		}
+	}()
 
 	// Start a message receiving loop.
-	for {
+	for !kernel.shutdown {
 		select {
+		case <-kernel.closed:
+			return nil
+
 		case v := <-shell:
 			// Handle shell messages.
 			if v.Err != nil {
-				log.Println(v.Err)
+				kernel.logger.Error("receiving shell message", "err", v.Err)
 				continue
 			}
 
 			msg, ids, err := WireMsgToComposedMsg(v.Msg.Frames, sockets.Key)
 			if err != nil {
-				log.Println(err)
-				return
+				return err
 			}
 
 			kernel.handleShellMsg(msgReceipt{msg, ids, sockets})
 
-		case <-stdin:
-			// TODO Handle stdin socket.
-			continue
-
 		case v := <-ctl:
 			if v.Err != nil {
-				log.Println(v.Err)
-				return
+				return v.Err
 			}
 
 			msg, ids, err := WireMsgToComposedMsg(v.Msg.Frames, sockets.Key)
 			if err != nil {
-				log.Println(err)
-				return
+				return err
 			}
 
 			kernel.handleShellMsg(msgReceipt{msg, ids, sockets})
 		}
 	}
+	return nil
+}
+
+// Close stops a running kernel and releases its sockets.
+func (kernel *Kernel) Close() error {
+	var err error
+	kernel.closeOnce.Do(func() {
+		close(kernel.closed)
+		err = errors.Join(releaseOutputRouter(), closeSockets(kernel.sockets))
+	})
+	return err
+}
+
+// closeSockets closes the sockets of `sg` that were created.
+func closeSockets(sg SocketGroup) error {
+	var errs []error
+	for _, s := range []Socket{sg.ShellSocket, sg.ControlSocket, sg.StdinSocket, sg.IOPubSocket, sg.HBSocket} {
+		if s.Socket != nil {
+			errs = append(errs, s.Socket.Close())
+		}
+	}
+	return errors.Join(errs...)
 }
 
 // prepareSockets sets up the ZMQ sockets through which the kernel
@@ -273,37 +431,37 @@ func (kernel *Kernel) handleShellMsg(receipt msgReceipt) {
 	// Tell the front-end that the kernel is working and when finished notify the
 	// front-end that the kernel is idle again.
 	if err := receipt.PublishKernelStatus(kernelBusy); err != nil {
-		log.Printf("Error publishing kernel status 'busy': %v\n", err)
+		kernel.logger.Error("publishing kernel status", "status", kernelBusy, "err", err)
 	}
 	defer func() {
 		if err := receipt.PublishKernelStatus(kernelIdle); err != nil {
-			log.Printf("Error publishing kernel status 'idle': %v\n", err)
+			kernel.logger.Error("publishing kernel status", "status", kernelIdle, "err", err)
 		}
 	}()
 
-	ir := kernel.ir
-
 	switch receipt.Msg.Header.MsgType {
 	case "kernel_info_request":
 		if err := sendKernelInfo(receipt, kernel.info); err != nil {
-			log.Fatal(err)
+			kernel.logger.Error("replying to kernel_info_request", "err", err)
 		}
 	case "is_complete_request":
 		if err := kernel.handleIsCompleteRequest(receipt); err != nil {
-			log.Fatal(err)
+			kernel.logger.Error("replying to is_complete_request", "err", err)
 		}
 	case "complete_request":
-		if err := handleCompleteRequest(ir, receipt); err != nil {
-			log.Fatal(err)
+		if err := kernel.handleCompleteRequest(receipt); err != nil {
+			kernel.logger.Error("replying to complete_request", "err", err)
 		}
 	case "execute_request":
 		if err := kernel.handleExecuteRequest(receipt); err != nil {
-			log.Fatal(err)
+			kernel.logger.Error("replying to execute_request", "err", err)
 		}
 	case "shutdown_request":
-		handleShutdownRequest(receipt)
+		if err := kernel.handleShutdownRequest(receipt); err != nil {
+			kernel.logger.Error("replying to shutdown_request", "err", err)
+		}
 	default:
-		log.Println("Unhandled shell message: ", receipt.Msg.Header.MsgType)
+		kernel.logger.Warn("unhandled shell message", "msg_type", receipt.Msg.Header.MsgType)
 	}
 }
 
@@ -360,82 +518,94 @@ func (kernel *Kernel) handleExecuteRequest(receipt msgReceipt) error {
 	reqcontent := receipt.Msg.Content.(map[string]interface{})
 	code := reqcontent["code"].(string)
 	silent := reqcontent["silent"].(bool)
+	allowStdin, _ := reqcontent["allow_stdin"].(bool)
+
+	storeHistory := !silent
+	if v, ok := reqcontent["store_history"].(bool); ok {
+		storeHistory = v
+	}
 
 	if !silent {
-		ExecCounter++
+		kernel.execCounter++
+		if !kernel.output.isShared() {
+			ExecCounter = kernel.execCounter
+		}
 	}
+	execCount := kernel.execCounter
 
 	// Prepare the map that will hold the reply content.
 	content := make(map[string]interface{})
-	content["execution_count"] = ExecCounter
+	content["execution_count"] = execCount
 
 	// Tell the front-end what the kernel is about to execute.
-	if err := receipt.PublishExecutionInput(ExecCounter, code); err != nil {
-		log.Printf("Error publishing execution input: %v\n", err)
+	if err := receipt.PublishExecutionInput(execCount, code); err != nil {
+		kernel.logger.Error("publishing execution input", "err", err)
 	}
 
-	// Redirect the standard out from the REPL.
-	oldStdout := os.Stdout
-	rOut, wOut, err := os.Pipe()
-	if err != nil {
-		return err
+	// Bound the volume of output this cell may publish.
+	limiter := newOutputLimiter(kernel.opts.OutputLimits, &receipt, kernel.logger)
+	defer limiter.Close()
+
+	// Forward all data written to stdout/stderr from now on to the front-end under this cell.
+	stdout, stderr := kernel.output.begin(&receipt, limiter)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	timeout := newCellTimeout(cancel, kernel.opts.CellTimeout)
+	defer timeout.stop()
+
+	cellID, _ := receipt.Msg.Metadata["cellId"].(string)
+
+	ec := &ExecutionContext{
+		Context:      ctx,
+		ExecCount:    execCount,
+		Dir:          kernel.dir,
+		Env:          kernel.env,
+		Silent:       silent,
+		StoreHistory: storeHistory,
+		Parent:       receipt.Msg.Header,
+		Metadata:     receipt.Msg.Metadata,
+		CellID:       cellID,
+		Stdout:       stdout,
+		Stderr:       stderr,
+		timeout:      timeout,
+		// inject the actual "Display" closure that displays multimedia data in Jupyter
+		Display: func(data Data) error {
+			// Publish the output written so far first, to keep it in order with the data.
+			flushWriters(kernel.logger, stdout, stderr)
+			if !limiter.reserveData(data) {
+				return nil
+			}
+			return receipt.PublishDisplayData(data)
+		},
 	}
-	os.Stdout = wOut
-
-	// Redirect the standard error from the REPL.
-	oldStderr := os.Stderr
-	rErr, wErr, err := os.Pipe()
-	if err != nil {
-		return err
+	if allowStdin {
+		ec.input = func(ctx context.Context, prompt string, password bool) (string, error) {
+			// Show the output written so far, which usually ends with the question.
+			flushWriters(kernel.logger, stdout, stderr)
+			return kernel.requestInput(ctx, &receipt, prompt, password)
+		}
 	}
-	os.Stderr = wErr
-
-	var writersWG sync.WaitGroup
-	writersWG.Add(2)
-
-	jupyterStdOut := JupyterStreamWriter{StreamStdout, &receipt}
-	jupyterStdErr := JupyterStreamWriter{StreamStderr, &receipt}
-	outerr := OutErr{&jupyterStdOut, &jupyterStdErr}
-
-	// Forward all data written to stdout/stderr to the front-end.
-	go func() {
-		defer writersWG.Done()
-		io.Copy(&jupyterStdOut, rOut)
-	}()
-
-	go func() {
-		defer writersWG.Done()
-		io.Copy(&jupyterStdErr, rErr)
-	}()
-
-	// inject the actual "Display" closure that displays multimedia data in Jupyter
-	ir := kernel.ir
 
 	// eval
-	vals, executionErr := doEval(ir, outerr, code)
-
-	// Close and restore the streams.
-	wOut.Close()
-	os.Stdout = oldStdout
+	stopWatch := startMemoryWatch(kernel.opts.MemoryLimit, stderr)
+	started := time.Now()
+	vals, executionErr := kernel.runCell(ec, code)
+	duration := time.Since(started)
+	stopWatch()
 
-	wErr.Close()
-	os.Stderr = oldStderr
-
-	// Wait for the writers to finish forwarding the data.
-	writersWG.Wait()
+	// Publish the output written by the cell before the result.
+	kernel.output.end(stdout, stderr)
 
 	if executionErr == nil {
-		// if the only non-nil value should be auto-rendered graphically, render it
-		data := kernel.autoRenderResults(vals)
-
 		content["status"] = "ok"
 		content["user_expressions"] = make(map[string]string)
+		if len(ec.Payload) != 0 {
+			content["payload"] = ec.Payload
+		}
 
-		if !silent && len(data.Data) != 0 {
-			// Publish the result of the execution.
-			if err := receipt.PublishExecutionResult(ExecCounter, data); err != nil {
-				log.Printf("Error publishing execution result: %v\n", err)
-			}
+		if !silent {
+			kernel.publishResults(&receipt, limiter, execCount, vals)
 		}
 	} else {
 		content["status"] = "error"
@@ -444,16 +614,77 @@ func (kernel *Kernel) handleExecuteRequest(receipt msgReceipt) error {
 		content["traceback"] = nil
 
 		if err := receipt.PublishExecutionError(executionErr.Error(), []string{executionErr.Error()}); err != nil {
-			log.Printf("Error publishing execution error: %v\n", err)
+			kernel.logger.Error("publishing execution error", "err", err)
 		}
 	}
 
-	// Send the output back to the notebook.
-	return receipt.Reply("execute_reply", content)
+	// Send the output back to the notebook, with the timing of the cell.
+	metadata := map[string]interface{}{
+		"started":  started.UTC().Format(time.RFC3339Nano),
+		"duration": duration.Seconds(),
+	}
+	return receipt.ReplyWithMetadata("execute_reply", content, metadata)
+}
+
+// handleStdinMsg passes an input_reply received on the stdin channel to the cell waiting for it.
+func (kernel *Kernel) handleStdinMsg(msg zmq4.Msg, err error) {
+	if err != nil {
+		kernel.logger.Error("receiving stdin message", "err", err)
+		return
+	}
+
+	reply, _, err := WireMsgToComposedMsg(msg.Frames, kernel.sockets.Key)
+	if err != nil {
+		kernel.logger.Error("decoding stdin message", "err", err)
+		return
+	}
+	if reply.Header.MsgType != "input_reply" {
+		kernel.logger.Warn("unexpected message on the stdin channel", "type", reply.Header.MsgType)
+		return
+	}
+
+	select {
+	case kernel.inputReplies <- reply:
+	default:
+		kernel.logger.Warn("dropping input_reply nobody is waiting for")
+	}
 }
 
-// handleShutdownRequest sends a "shutdown" message.
-func handleShutdownRequest(receipt msgReceipt) {
+// requestInput sends an input_request for the execute_request of `receipt` and waits for the reply.
+func (kernel *Kernel) requestInput(ctx context.Context, receipt *msgReceipt, prompt string, password bool) (string, error) {
+	// Discard a reply to an earlier request that was given up.
+	select {
+	case <-kernel.inputReplies:
+	default:
+	}
+
+	request, err := NewMsg("input_request", receipt.Msg)
+	if err != nil {
+		return "", err
+	}
+	request.Content = map[string]interface{}{
+		"prompt":   prompt,
+		"password": password,
+	}
+	err = kernel.sockets.StdinSocket.RunWithSocket(func(stdin zmq4.Socket) error {
+		return receipt.SendResponse(stdin, request)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	select {
+	case reply := <-kernel.inputReplies:
+		content, _ := reply.Content.(map[string]interface{})
+		value, _ := content["value"].(string)
+		return value, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// handleShutdownRequest sends a "shutdown" message and stops the kernel.
+func (kernel *Kernel) handleShutdownRequest(receipt msgReceipt) error {
 	content := receipt.Msg.Content.(map[string]interface{})
 	restart := content["restart"].(bool)
 
@@ -461,19 +692,20 @@ func handleShutdownRequest(receipt msgReceipt) {
 		Restart: restart,
 	}
 
-	if err := receipt.Reply("shutdown_reply", reply); err != nil {
-		log.Fatal(err)
+	if hook := kernel.opts.Hooks.OnShutdown; hook != nil {
+		hook(kernel, restart)
 	}
 
-	log.Println("Shutting down in response to shutdown_request")
-	os.Exit(0)
+	kernel.shutdown = true
+	return receipt.Reply("shutdown_reply", reply)
 }
 
-// startHeartbeat starts a go-routine for handling heartbeat ping messages sent over the given `hbSocket`. The `wg`'s
+// startHeartbeat starts a go-routine for handling heartbeat ping messages sent over the heartbeat socket. The `wg`'s
 // `Done` method is invoked after the thread is completely shutdown. To request a shutdown the returned `shutdown` channel
 // can be closed.
-func startHeartbeat(hbSocket Socket, wg *sync.WaitGroup) (shutdown chan struct{}) {
+func (kernel *Kernel) startHeartbeat(wg *sync.WaitGroup) (shutdown chan struct{}) {
 	quit := make(chan struct{})
+	hbSocket := kernel.sockets.HBSocket
 
 	// Start the handler that will echo any received messages back to the sender.
 	wg.Add(1)
@@ -499,26 +731,30 @@ func startHeartbeat(hbSocket Socket, wg *sync.WaitGroup) (shutdown chan struct{}
 			}
 		}()
 
-		timeout := time.NewTimer(500 * time.Second)
+		timeout := time.NewTimer(kernel.opts.HeartbeatTimeout)
 		defer timeout.Stop()
 
 		for {
-			timeout.Reset(500 * time.Second)
+			timeout.Reset(kernel.opts.HeartbeatTimeout)
 			select {
 			case <-quit:
 				return
 			case <-timeout.C:
+				if hook := kernel.opts.Hooks.OnHeartbeatTimeout; hook != nil {
+					hook(kernel)
+				}
 				continue
 			case v := <-msgs:
-				hbSocket.RunWithSocket(func(echo zmq4.Socket) error {
-					if v.Err != nil {
-						log.Fatalf("Error reading heartbeat ping bytes: %v\n", v.Err)
-						return v.Err
-					}
+				if v.Err != nil {
+					// The socket is closed or broken, so there will be no further pings.
+					kernel.logger.Error("reading heartbeat ping bytes", "err", v.Err)
+					return
+				}
 
+				hbSocket.RunWithSocket(func(echo zmq4.Socket) error {
 					// Send the received byte string back to let the front-end know that the kernel is alive.
 					if err := echo.Send(v.Msg); err != nil {
-						log.Printf("Error sending heartbeat pong bytes: %b\n", err)
+						kernel.logger.Error("sending heartbeat pong bytes", "err", err)
 						return err
 					}
 
@@ -530,113 +766,3 @@ func startHeartbeat(hbSocket Socket, wg *sync.WaitGroup) (shutdown chan struct{}
 
 	return quit
 }
-
-// find and execute special commands in code, remove them from returned string
-func evalSpecialCommands(outerr OutErr, code string) string {
-	lines := strings.Split(code, "\n")
-	stop := false
-	for i, line := range lines {
-		line = strings.TrimSpace(line)
-		if len(line) != 0 {
-			switch line[0] {
-			case '%':
-				evalSpecialCommand(outerr, line)
-				lines[i] = ""
-			case '$', '!':
-				evalShellCommand(outerr, line)
-				lines[i] = ""
-			default:
-				// if a line is NOT a special command,
-				// stop processing special commands
-				stop = true
-			}
-		}
-		if stop {
-			break
-		}
-	}
-	return strings.Join(lines, "\n")
-}
-
-// execute special command. line must start with '%'
-func evalSpecialCommand(outerr OutErr, line string) {
-	const help string = `
-available special commands (%):
-%cd [path]
-%help
-
-execute shell commands ($/!): $command [args...]
-example:
-$ls -l
-`
-
-	args := strings.SplitN(line, " ", 2)
-	cmd := args[0]
-	arg := ""
-	if len(args) > 1 {
-		arg = args[1]
-	}
-	switch cmd {
-	case "%cd":
-		if arg == "" {
-			home, err := os.UserHomeDir()
-			if err != nil {
-				panic(fmt.Errorf("error getting user home directory: %v", err))
-			}
-			arg = home
-		}
-		err := os.Chdir(arg)
-		if err != nil {
-			panic(fmt.Errorf("error setting current directory to %q: %v", arg, err))
-		}
-	case "%help":
-		outerr.out.Write([]byte(help))
-	default:
-		panic(fmt.Errorf("unknown special command: %q\n%s", line, help))
-	}
-}
-
-// execute shell command. line must start with '!' or '$'
-func evalShellCommand(outerr OutErr, line string) {
-	args := strings.Fields(line[1:])
-	if len(args) <= 0 {
-		return
-	}
-
-	var writersWG sync.WaitGroup
-	writersWG.Add(2)
-
-	cmd := exec.Command(args[0], args[1:]...)
-
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		panic(fmt.Errorf("Command.StdoutPipe() failed: %v", err))
-	}
-
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		panic(fmt.Errorf("Command.StderrPipe() failed: %v", err))
-	}
-
-	go func() {
-		defer writersWG.Done()
-		io.Copy(outerr.out, stdout)
-	}()
-
-	go func() {
-		defer writersWG.Done()
-		io.Copy(outerr.err, stderr)
-	}()
-
-	err = cmd.Start()
-	if err != nil {
-		panic(fmt.Errorf("error starting command '%s': %v", line[1:], err))
-	}
-
-	err = cmd.Wait()
-	if err != nil {
-		panic(fmt.Errorf("error waiting for command '%s': %v", line[1:], err))
-	}
-
-	writersWG.Wait()
-}
@@ -4,12 +4,23 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
 	"log"
+	"net"
 	"os"
+	"os/exec"
+	"reflect"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	"github.com/go-zeromq/zmq4"
 )
@@ -30,6 +41,7 @@ var (
 	ip            string
 	shellPort     int
 	iopubPort     int
+	stdinPort     int
 )
 
 //==============================================================================
@@ -59,13 +71,15 @@ func runTest(m *testing.M) int {
 	ip = connInfo.IP
 	shellPort = connInfo.ShellPort
 	iopubPort = connInfo.IOPubPort
+	stdinPort = connInfo.StdinPort
 
 	// Start the kernel.
-	go RunKernel(connInfo, KernelInfo{
+	preserveTestOutput()
+	go RunKernel(testInterpreter{}, connInfo, KernelInfo{
 		ProtocolVersion:       ProtocolVersion,
 		Implementation:        "gophernotes",
 		ImplementationVersion: "1.0.0",
-		Banner:                fmt.Sprintf("Go kernel: gophernotes - v%s", "1.0.0"
+		Banner:                fmt.Sprintf("Go kernel: gophernotes - v%s", "1.0.0"),
 		LanguageInfo: KernelLanguageInfo{
 			Name:          "go",
 			Version:       runtime.Version(),
@@ -82,6 +96,167 @@ func runTest(m *testing.M) int {
 
 //==============================================================================
 
+// testInterpreter is a minimal Interpreter used to drive the kernel in tests. Every non-empty line
+// of a cell must be a call to one of its builtins with literal arguments:
+//
+//	print("text")      writes text to the standard output of the process
+//	eprint("text")     writes text to the standard error of the process
+//	exec("cmd", args)  runs a command inheriting the standard output of the process
+//	ctxprint("text")   writes text to ExecutionContext.Stdout
+//	cellinfo()         returns the execution count and cell id of the ExecutionContext
+//	value("text")      returns text as a result value
+//	sleep("100ms")     pauses the evaluation
+//	repeat(n, call)    evaluates call n times
+//	after("1s", call)  evaluates call in a new goroutine after the given delay
+//	wait()             waits until the context of the cell is cancelled
+//	panic("text")      panics with text
+//	variable("name")   returns the variable set with Assign
+//
+// It implements VariableLookup with the variables set with Assign, and a few constant variables.
+type testInterpreter struct{}
+
+// testVariables holds the variables of testInterpreter.
+var testVariables sync.Map
+
+func init() {
+	testVariables.Store("name", "big world")
+	testVariables.Store("files", []string{"a b", "c"})
+	testVariables.Store("answer", 42)
+	testVariables.Store("ok", true)
+}
+
+func (testInterpreter) Lookup(name string) (any, bool) {
+	return testVariables.Load(name)
+}
+
+func (testInterpreter) Assign(name string, value any) error {
+	testVariables.Store(name, value)
+	return nil
+}
+
+func (testInterpreter) CompleteWords(code string, cursorPos int) (prefix string, completions []string, tail string) {
+	return "", nil, ""
+}
+
+func (ir testInterpreter) Eval(code string) (values []any, err error) {
+	return ir.EvalContext(&ExecutionContext{Stdout: testStdout(), Stderr: testStderr()}, code)
+}
+
+func (ir testInterpreter) EvalContext(ec *ExecutionContext, code string) (values []any, err error) {
+	for _, line := range strings.Split(code, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		expr, err := parser.ParseExpr(line)
+		if err != nil {
+			return values, err
+		}
+		vals, err := ir.call(ec, expr)
+		values = append(values, vals...)
+		if err != nil {
+			return values, err
+		}
+	}
+	return values, nil
+}
+
+// call evaluates a single builtin call expression.
+func (ir testInterpreter) call(ec *ExecutionContext, expr ast.Expr) ([]any, error) {
+	call, ok := expr.(*ast.CallExpr)
+	if !ok {
+		return nil, fmt.Errorf("not a call: %T", expr)
+	}
+	name, ok := call.Fun.(*ast.Ident)
+	if !ok {
+		return nil, fmt.Errorf("not a builtin: %T", call.Fun)
+	}
+
+	arg := func(i int) string {
+		if i >= len(call.Args) {
+			return ""
+		}
+		lit, ok := call.Args[i].(*ast.BasicLit)
+		if !ok {
+			return ""
+		}
+		if lit.Kind == token.STRING {
+			s, _ := strconv.Unquote(lit.Value)
+			return s
+		}
+		return lit.Value
+	}
+
+	switch name.Name {
+	case "print":
+		_, err := io.WriteString(testStdout(), arg(0))
+		return nil, err
+	case "eprint":
+		_, err := io.WriteString(testStderr(), arg(0))
+		return nil, err
+	case "exec":
+		args := make([]string, len(call.Args))
+		for i := range args {
+			args[i] = arg(i)
+		}
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdout = testStdout()
+		return nil, cmd.Run()
+	case "ctxprint":
+		_, err := io.WriteString(ec.Stdout, arg(0))
+		return nil, err
+	case "cellinfo":
+		return []any{fmt.Sprintf("%d %s", ec.ExecCount, ec.CellID)}, nil
+	case "value":
+		return []any{arg(0)}, nil
+	case "sleep":
+		d, err := time.ParseDuration(arg(0))
+		if err != nil {
+			return nil, err
+		}
+		time.Sleep(d)
+		return nil, nil
+	case "repeat":
+		n, err := strconv.Atoi(arg(0))
+		if err != nil || len(call.Args) < 2 {
+			return nil, fmt.Errorf("repeat needs a count and a call")
+		}
+		var values []any
+		for i := 0; i < n; i++ {
+			vals, err := ir.call(ec, call.Args[1])
+			values = append(values, vals...)
+			if err != nil {
+				return values, err
+			}
+		}
+		return values, nil
+	case "after":
+		d, err := time.ParseDuration(arg(0))
+		if err != nil || len(call.Args) < 2 {
+			return nil, fmt.Errorf("after needs a delay and a call")
+		}
+		go func() {
+			time.Sleep(d)
+			ir.call(ec, call.Args[1])
+		}()
+		return nil, nil
+	case "wait":
+		<-ec.Context.Done()
+		return nil, context.Cause(ec.Context)
+	case "panic":
+		panic(arg(0))
+	case "variable":
+		value, ok := testVariables.Load(arg(0))
+		if !ok {
+			return nil, fmt.Errorf("undefined: %s", arg(0))
+		}
+		return []any{value}, nil
+	}
+	return nil, fmt.Errorf("unknown builtin %q", name.Name)
+}
+
+//==============================================================================
+
 // TestEvaluate tests the evaluation of consecutive cells.
 func TestEvaluate(t *testing.T) {
 	cases := []struct {
@@ -89,74 +264,24 @@ func TestEvaluate(t *testing.T) {
 		Output string
 	}{
 		{[]string{
-			"a := 1",
-			"a",
+			`value("1")`,
 		}, "1"},
 		{[]string{
-			"a = 2",
-			"a + 3",
-		}, "5"},
-		{[]string{
-			"func myFunc(x int) int {",
-			"    return x+1",
-			"}",
-			"myFunc(1)",
-		}, "2"},
-		{[]string{
-			"b := myFunc(1)",
-		}, ""},
-		{[]string{
-			"type Rect struct {",
-			"    Width, Height int",
-			"}",
-			"Rect{10, 30}",
-		}, "{10 30}"},
-		{[]string{
-			"type Rect struct {",
-			"    Width, Height int",
-			"}",
-			"&Rect{10, 30}",
-		}, "&{10 30}"},
+			`value("a")`,
+			`value("b")`,
+		}, "b"},
 		{[]string{
-			"func a(b int) (int, int) {",
-			"    return 2 + b, b",
-			"}",
-			"a(10)",
-		}, "12 10"},
+			`variable("name")`,
+		}, "big world"},
 		{[]string{
-			`import "errors"`,
-			"func a() (interface{}, error) {",
-			`    return nil, errors.New("To err is human")`,
-			"}",
-			"a()",
-		}, "<nil> To err is human"},
+			`repeat(3, value("c"))`,
+		}, "c"},
 		{[]string{
-			`c := []string{"gophernotes", "is", "super", "bad"}`,
-			"c[:3]",
-		}, "[gophernotes is super]"},
-		{[]string{
-			"m := map[string]int{",
-			`    "a": 10,`,
-			`    "c": 30,`,
-			"}",
-			`m["c"]`,
-		}, "30 true"},
-		{[]string{
-			"if 1 < 2 {",
-			"    3",
-			"}",
+			`print("no result\n")`,
 		}, ""},
 		{[]string{
-			"d := 10",
-			"d++",
+			`sleep("10ms")`,
 		}, ""},
-		{[]string{
-			"out := make(chan int)",
-			"go func() {",
-			"    out <- 123",
-			"}()",
-			"<-out",
-		}, "123 true"},
 	}
 
 	t.Logf("Should be able to evaluate valid code in notebook cells.")
@@ -239,27 +364,23 @@ func TestPrintStdout(t *testing.T) {
 		Output []string
 	}{
 		{[]string{
-			`import "fmt"`,
-			"a := 1",
-			"fmt.Println(a)",
+			`print("1\n")`,
 		}, []string{"1\n"}},
 		{[]string{
-			"a = 2",
-			"fmt.Print(a)",
+			`print("2")`,
 		}, []string{"2"}},
 		{[]string{
-			`import "os"`,
-			`os.Stdout.WriteString("3")`,
+			`ctxprint("3")`,
 		}, []string{"3"}},
 		{[]string{
-			`fmt.Fprintf(os.Stdout, "%d\n", 4)`,
+			`exec("echo", "4")`,
 		}, []string{"4\n"}},
 		{[]string{
-			`import "time"`,
-			"for i := 0; i < 3; i++ {",
-			"    fmt.Println(i)",
-			"    time.Sleep(500 * time.Millisecond)", // Stall to prevent prints from buffering into single message.
-			"}",
+			`print("0\n")`,
+			`sleep("500ms")`, // Stall to prevent prints from buffering into single message.
+			`print("1\n")`,
+			`sleep("500ms")`,
+			`print("2\n")`,
 		}, []string{"0\n", "1\n", "2\n"}},
 	}
 
@@ -295,20 +416,17 @@ func TestPrintStderr(t *testing.T) {
 		Output []string
 	}{
 		{[]string{
-			`import "fmt"`,
-			`import "os"`,
-			"a := 1",
-			"fmt.Fprintln(os.Stderr, a)",
+			`eprint("1\n")`,
 		}, []string{"1\n"}},
 		{[]string{
-			`os.Stderr.WriteString("2")`,
+			`eprint("2")`,
 		}, []string{"2"}},
 		{[]string{
-			`import "time"`,
-			"for i := 0; i < 3; i++ {",
-			"    fmt.Fprintln(os.Stderr, i)",
-			"    time.Sleep(500 * time.Millisecond)", // Stall to prevent prints from buffering into single message.
-			"}",
+			`eprint("0\n")`,
+			`sleep("500ms")`, // Stall to prevent prints from buffering into single message.
+			`eprint("1\n")`,
+			`sleep("500ms")`,
+			`eprint("2\n")`,
 		}, []string{"0\n", "1\n", "2\n"}},
 	}
 
@@ -337,32 +455,386 @@ cases:
 	}
 }
 
+// TestStreamCoalescing tests that bursts of small writes are coalesced into few "stream" messages without
+// splitting multi-byte characters.
+func TestStreamCoalescing(t *testing.T) {
+	stdout, _ := testOutputStream(t, `repeat(5000, print("héllo\n"))`)
+
+	if len(stdout) == 0 || len(stdout) > 10 {
+		t.Fatalf("\t%s Expected a handful of coalesced stream messages but got %d", failure, len(stdout))
+	}
+
+	joined := strings.Join(stdout, "")
+	if joined != strings.Repeat("héllo\n", 5000) {
+		t.Fatalf("\t%s Coalesced stream messages do not add up to the written data", failure)
+	}
+	for _, msg := range stdout {
+		if !utf8.ValidString(msg) {
+			t.Fatalf("\t%s Stream message contains a split UTF-8 sequence", failure)
+		}
+	}
+	t.Logf("\t%s Published %d coalesced stream message(s).", success, len(stdout))
+}
+
+// TestStreamSeparateWrites tests that writes separated by a pause are published as separate messages.
+func TestStreamSeparateWrites(t *testing.T) {
+	stdout, _ := testOutputStream(t, strings.Join([]string{
+		`print("0\n")`,
+		`sleep("300ms")`,
+		`print("1\n")`,
+	}, "\n"))
+
+	if len(stdout) != 2 || stdout[0] != "0\n" || stdout[1] != "1\n" {
+		t.Fatalf("\t%s Unexpected stream messages %q", failure, stdout)
+	}
+	t.Logf("\t%s Returned the expected messages on stdout.", success)
+}
+
+// TestBackgroundOutput tests that output written by a goroutine after its cell finished is published
+// under that cell.
+func TestBackgroundOutput(t *testing.T) {
+	client, closeClient := newTestJupyterClient(t)
+	defer closeClient()
+
+	_, pub := client.executeCode(t, `after("300ms", print("late\n"))`)
+	if len(pub) == 0 {
+		t.Fatalf("\t%s Execution did not publish any message", failure)
+	}
+	parent := pub[0].ParentHeader.MsgID
+
+	msg := client.recvIOSub(t, 2*time.Second)
+	assertMsgTypeEquals(t, msg, "stream")
+
+	content := getMsgContentAsJSONObject(t, msg)
+	if text := getString(t, "content", content, "text"); text != "late\n" {
+		t.Fatalf("\t%s Unexpected late output %q", failure, text)
+	}
+	if msg.ParentHeader.MsgID != parent {
+		t.Fatalf("\t%s Late output was not published under the originating cell", failure)
+	}
+	t.Logf("\t%s Published late output under the originating cell.", success)
+}
+
+// TestExecutionContext tests that an Evaluator receives the execution count, cell id and output streams
+// of the cell.
+func TestExecutionContext(t *testing.T) {
+	client, closeClient := newTestJupyterClient(t)
+	defer closeClient()
+
+	request := client.newExecuteRequest(t, `ctxprint("ctx\n")`+"\n"+`cellinfo()`)
+	request.Metadata["cellId"] = "cell-1"
+
+	reply, pub := client.performJupyterRequest(t, request, 10*time.Second)
+	content := getMsgContentAsJSONObject(t, reply)
+	count, _ := content["execution_count"].(float64)
+
+	var stdout []string
+	for _, pubMsg := range pub {
+		if pubMsg.Header.MsgType != "stream" {
+			continue
+		}
+		content := getMsgContentAsJSONObject(t, pubMsg)
+		stdout = append(stdout, getString(t, "content", content, "text"))
+	}
+
+	if strings.Join(stdout, "") != "ctx\n" {
+		t.Fatalf("\t%s Unexpected stream messages %q", failure, stdout)
+	}
+	expected := []string{fmt.Sprintf("execute_result %d cell-1", int(count))}
+	if results := testResults(t, pub); !reflect.DeepEqual(results, expected) {
+		t.Fatalf("\t%s Unexpected results %q, expected %q", failure, results, expected)
+	}
+	t.Logf("\t%s Evaluator received the execution context.", success)
+}
+
+// TestConcurrentKernels tests that two kernels in the same process execute cells concurrently with their own
+// execution counters, working directories and cell output.
+func TestConcurrentKernels(t *testing.T) {
+	dirs := []string{t.TempDir(), t.TempDir()}
+
+	for i, dir := range dirs {
+		i, dir := i, dir
+		t.Run(fmt.Sprint("kernel", i), func(t *testing.T) {
+			t.Parallel()
+
+			kernel, client := startTestKernel(t)
+
+			marker := fmt.Sprintf("kernel %d\n", i)
+			code := fmt.Sprintf("%%cd %s\nrepeat(5, ctxprint(%q))\nrepeat(5, sleep(\"50ms\"))\ncellinfo()", dir, marker)
+
+			for count := 1; count <= 2; count++ {
+				content, pub := client.executeCode(t, code)
+				if status := getString(t, "content", content, "status"); status != "ok" {
+					t.Fatalf("\t%s Execution encountered error: %s", failure, content["evalue"])
+				}
+				if n, _ := content["execution_count"].(float64); int(n) != count {
+					t.Fatalf("\t%s Expected execution count %d but got %v", failure, count, n)
+				}
+
+				var stdout []string
+				for _, pubMsg := range pub {
+					if pubMsg.Header.MsgType == "stream" {
+						content := getMsgContentAsJSONObject(t, pubMsg)
+						stdout = append(stdout, getString(t, "content", content, "text"))
+					}
+				}
+				if strings.Join(stdout, "") != strings.Repeat(marker, 5) {
+					t.Fatalf("\t%s Unexpected output %q", failure, stdout)
+				}
+				expected := []string{fmt.Sprintf("execute_result %d ", count)}
+				if results := testResults(t, pub); !reflect.DeepEqual(results, expected) {
+					t.Fatalf("\t%s Unexpected results %q", failure, results)
+				}
+			}
+
+			if kernel.dir != dir {
+				t.Fatalf("\t%s Expected working directory %q but got %q", failure, dir, kernel.dir)
+			}
+			t.Logf("\t%s Kernel kept its own state and output.", success)
+		})
+	}
+}
+
+// TestConcurrentKernelsProcessOutput tests that the standard output of the process, where fmt.Println
+// writes, is not published into the cell of another kernel while two kernels run in the process, and
+// that the notebook is warned instead.
+func TestConcurrentKernelsProcessOutput(t *testing.T) {
+	client, closeClient := newTestJupyterClient(t)
+	defer closeClient()
+	_, other := startTestKernel(t)
+
+	stdout, _ := testOutputStreamFor(t, other, `after("100ms", print("other kernel\n"))`+"\n"+`ctxprint("other\n")`)
+	if len(stdout) != 1 || stdout[0] != "other\n" {
+		t.Fatalf("\t%s Unexpected output %q", failure, stdout)
+	}
+
+	// The cell of the first kernel starts last and runs while the other kernel writes.
+	stdout, stderr := testOutputStreamFor(t, client, `print("first kernel\n")`+"\n"+`sleep("300ms")`+"\n"+`ctxprint("first\n")`)
+	if len(stdout) != 1 || stdout[0] != "first\n" {
+		t.Fatalf("\t%s Process output was published in a cell: %q", failure, stdout)
+	}
+	if strings.Join(stderr, "") != sharedOutputWarning {
+		t.Fatalf("\t%s Expected a single warning about process output, got %q", failure, stderr)
+	}
+	t.Logf("\t%s Process output was not routed across kernels.", success)
+}
+
+// TestExecCounter tests that ExecCounter follows the execution counter while a single kernel runs.
+func TestExecCounter(t *testing.T) {
+	client, closeClient := newTestJupyterClient(t)
+	defer closeClient()
+
+	content, _ := client.executeCode(t, `value("x")`)
+	if count, _ := content["execution_count"].(float64); int(count) != ExecCounter {
+		t.Fatalf("\t%s ExecCounter is %d, expected %v", failure, ExecCounter, count)
+	}
+	t.Logf("\t%s ExecCounter was updated.", success)
+}
+
+// TestKernelOptions tests that options passed to NewKernel are applied.
+func TestKernelOptions(t *testing.T) {
+	started := make(chan *Kernel, 1)
+	_, client := startTestKernel(t,
+		WithMagics(false),
+		WithLifecycleHooks(LifecycleHooks{
+			OnStart: func(kernel *Kernel) { started <- kernel },
+		}),
+	)
+
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatalf("\t%s OnStart hook was not called", failure)
+	}
+
+	// With magics disabled, the line reaches the interpreter, which cannot parse it.
+	content, _ := client.executeCode(t, "%help")
+	if status := getString(t, "content", content, "status"); status != "error" {
+		t.Fatalf("\t%s Expected %%help to be passed to the interpreter", failure)
+	}
+	t.Logf("\t%s Kernel options were applied.", success)
+}
+
+// TestHeartbeatTimeoutNotPositive tests that a heartbeat timeout that is not positive keeps the default
+// instead of calling OnHeartbeatTimeout continuously.
+func TestHeartbeatTimeoutNotPositive(t *testing.T) {
+	var timeouts atomic.Int32
+	kernel, _ := startTestKernel(t,
+		WithHeartbeatTimeout(0),
+		WithLifecycleHooks(LifecycleHooks{
+			OnHeartbeatTimeout: func(*Kernel) { timeouts.Add(1) },
+		}),
+	)
+
+	time.Sleep(200 * time.Millisecond)
+	if n := timeouts.Load(); n != 0 {
+		t.Fatalf("\t%s OnHeartbeatTimeout was called %d times", failure, n)
+	}
+	if kernel.opts.HeartbeatTimeout != defaultKernelOptions().HeartbeatTimeout {
+		t.Fatalf("\t%s Expected the default heartbeat timeout but got %v", failure, kernel.opts.HeartbeatTimeout)
+	}
+	t.Logf("\t%s Heartbeat timeout kept the default.", success)
+}
+
+// TestExecutionEvents tests that execution hooks can rewrite and veto cells and receive their results.
+func TestExecutionEvents(t *testing.T) {
+	kernel, client := startTestKernel(t)
+
+	results := make(chan CellResult, 2)
+	kernel.Events().OnPreRunCell(func(info *CellInfo) error {
+		if info.Code == "skip" {
+			return ErrSkipCell
+		}
+		info.Code = strings.ReplaceAll(info.Code, "hello", "goodbye")
+		return nil
+	})
+	kernel.Events().OnPostExecute(func(result *CellResult) {
+		results <- *result
+	})
+
+	stdout, _ := testOutputStreamFor(t, client, `ctxprint("hello\n")`)
+	if len(stdout) != 1 || stdout[0] != "goodbye\n" {
+		t.Fatalf("\t%s Expected the cell to be rewritten but got %q", failure, stdout)
+	}
+	if result := <-results; result.Info.Code != `ctxprint("goodbye\n")` || result.Err != nil {
+		t.Fatalf("\t%s Unexpected cell result %+v", failure, result)
+	}
+
+	content, _ := client.executeCode(t, "skip")
+	if status := getString(t, "content", content, "status"); status != "ok" {
+		t.Fatalf("\t%s Expected the skipped cell to succeed", failure)
+	}
+	if result := <-results; !result.Skipped {
+		t.Fatalf("\t%s Expected the cell to be skipped", failure)
+	}
+	t.Logf("\t%s Execution hooks were applied.", success)
+}
+
+// TestExecutionEventsOrder tests that the execution hooks are called in the order of IPython: pre_execute,
+// pre_run_cell, post_execute, then post_run_cell.
+func TestExecutionEventsOrder(t *testing.T) {
+	kernel, client := startTestKernel(t)
+
+	calls := make(chan string, 4)
+	kernel.Events().OnPostRunCell(func(*CellResult) { calls <- "post_run_cell" })
+	kernel.Events().OnPostExecute(func(*CellResult) { calls <- "post_execute" })
+	kernel.Events().OnPreRunCell(func(*CellInfo) error { calls <- "pre_run_cell"; return nil })
+	kernel.Events().OnPreExecute(func(*CellInfo) error { calls <- "pre_execute"; return nil })
+
+	client.executeCode(t, `value("x")`)
+
+	var order []string
+	for i := 0; i < 4; i++ {
+		order = append(order, <-calls)
+	}
+	expected := []string{"pre_execute", "pre_run_cell", "post_execute", "post_run_cell"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Fatalf("\t%s Hooks were called in the order %q, expected %q", failure, order, expected)
+	}
+	t.Logf("\t%s Hooks were called in order.", success)
+}
+
+// startTestKernel starts an additional kernel on free ports with the given options and connects a client to it.
+// Both are closed when the test finishes.
+func startTestKernel(t *testing.T, options ...Option) (*Kernel, testJupyterClient) {
+	t.Helper()
+
+	connInfo := newTestConnectionInfo(t)
+	kernel, err := NewKernel(testInterpreter{}, connInfo, KernelInfo{ProtocolVersion: ProtocolVersion}, options...)
+	if err != nil {
+		t.Fatalf("\t%s NewKernel: %s", failure, err)
+	}
+	t.Cleanup(func() { kernel.Close() })
+	go kernel.Run()
+
+	client, closeClient := newTestJupyterClientFor(t, connInfo)
+	t.Cleanup(closeClient)
+
+	return kernel, client
+}
+
+// newTestConnectionInfo returns connection info for a kernel listening on free local ports.
+func newTestConnectionInfo(t *testing.T) ConnectionInfo {
+	t.Helper()
+
+	var ports [5]int
+	for i := range ports {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("\t%s net.Listen: %s", failure, err)
+		}
+		ports[i] = l.Addr().(*net.TCPAddr).Port
+		l.Close()
+	}
+
+	return ConnectionInfo{
+		SignatureScheme: "hmac-sha256",
+		Transport:       "tcp",
+		IP:              "127.0.0.1",
+		Key:             connectionKey,
+		ShellPort:       ports[0],
+		IOPubPort:       ports[1],
+		ControlPort:     ports[2],
+		StdinPort:       ports[3],
+		HBPort:          ports[4],
+	}
+}
+
 //==============================================================================
 
 // testJupyterClient holds references to the 2 sockets it uses to communicate with the kernel.
 type testJupyterClient struct {
 	shellSocket zmq4.Socket
 	ioSocket    zmq4.Socket
+	stdinSocket zmq4.Socket
 }
 
+// testClientCount numbers the test clients to give them unique socket identities.
+var testClientCount atomic.Int64
+
 // newTestJupyterClient creates and connects a fresh client to the kernel. Upon error, newTestJupyterClient
 // will Fail the test.
 func newTestJupyterClient(t *testing.T) (testJupyterClient, func()) {
 	t.Helper()
 
+	return newTestJupyterClientFor(t, ConnectionInfo{
+		Transport: transport,
+		IP:        ip,
+		ShellPort: shellPort,
+		IOPubPort: iopubPort,
+		StdinPort: stdinPort,
+	})
+}
+
+// newTestJupyterClientFor creates and connects a fresh client to the kernel listening on `connInfo`. Upon error,
+// newTestJupyterClientFor will Fail the test.
+func newTestJupyterClientFor(t *testing.T, connInfo ConnectionInfo) (testJupyterClient, func()) {
+	t.Helper()
+
 	var (
 		err       error
 		ctx       = context.Background()
-		addrShell = fmt.Sprintf("%s://%s:%d", transport, ip, shellPort)
-		addrIO    = fmt.Sprintf("%s://%s:%d", transport, ip, iopubPort)
+		addrShell = fmt.Sprintf("%s://%s:%d", connInfo.Transport, connInfo.IP, connInfo.ShellPort)
+		addrIO    = fmt.Sprintf("%s://%s:%d", connInfo.Transport, connInfo.IP, connInfo.IOPubPort)
+		addrStdin = fmt.Sprintf("%s://%s:%d", connInfo.Transport, connInfo.IP, connInfo.StdinPort)
+
+		// The shell and stdin sockets share their identity, so that the kernel can address input
+		// requests to the client.
+		id = zmq4.WithID(zmq4.SocketIdentity(fmt.Sprintf("client-%d", testClientCount.Add(1))))
 	)
 
 	// Prepare the shell socket.
-	shell := zmq4.NewReq(ctx)
+	shell := zmq4.NewReq(ctx, id)
 	if err = shell.Dial(addrShell); err != nil {
 		t.Fatalf("\t%s shell.Connect: %s", failure, err)
 	}
 
+	// Prepare the stdin socket.
+	stdin := zmq4.NewDealer(ctx, id)
+	if err = stdin.Dial(addrStdin); err != nil {
+		t.Fatalf("\t%s stdin.Connect: %s", failure, err)
+	}
+
 	// Prepare the IOPub socket.
 	iopub := zmq4.NewSub(ctx)
 	if err = iopub.Dial(addrIO); err != nil {
@@ -376,10 +848,13 @@ func newTestJupyterClient(t *testing.T) (testJupyterClient, func()) {
 	// Wait for a second to give the tcp connection time to complete to avoid missing the early pub messages.
 	time.Sleep(1 * time.Second)
 
-	return testJupyterClient{shell, iopub}, func() {
+	return testJupyterClient{shell, iopub, stdin}, func() {
 		if err := shell.Close(); err != nil {
 			t.Errorf("\t%s shell.Close: %s", failure, err)
 		}
+		if err := stdin.Close(); err != nil {
+			t.Errorf("\t%s stdin.Close: %s", failure, err)
+		}
 		if err = iopub.Close(); err != nil {
 			t.Errorf("\t%s iopub.Close: %s", failure, err)
 		}
@@ -419,12 +894,14 @@ func (client *testJupyterClient) recvShellReply(t *testing.T, timeout time.Durat
 	go func() {
 		repMsgParts, err := client.shellSocket.Recv()
 		if err != nil {
-			t.Fatalf("\t%s Shell socket RecvMessageBytes: %s", failure, err)
+			t.Errorf("\t%s Shell socket RecvMessageBytes: %s", failure, err)
+			return
 		}
 
 		msgParsed, _, err := WireMsgToComposedMsg(repMsgParts.Frames, []byte(connectionKey))
 		if err != nil {
-			t.Fatalf("\t%s Could not parse wire message: %s", failure, err)
+			t.Errorf("\t%s Could not parse wire message: %s", failure, err)
+			return
 		}
 
 		ch <- msgParsed
@@ -452,12 +929,14 @@ func (client *testJupyterClient) recvIOSub(t *testing.T, timeout time.Duration)
 	go func() {
 		repMsgParts, err := client.ioSocket.Recv()
 		if err != nil {
-			t.Fatalf("\t%s IOPub socket RecvMessageBytes: %s", failure, err)
+			t.Errorf("\t%s IOPub socket RecvMessageBytes: %s", failure, err)
+			return
 		}
 
 		msgParsed, _, err := WireMsgToComposedMsg(repMsgParts.Frames, []byte(connectionKey))
 		if err != nil {
-			t.Fatalf("\t%s Could not parse wire message: %s", failure, err)
+			t.Errorf("\t%s Could not parse wire message: %s", failure, err)
+			return
 		}
 
 		ch <- msgParsed
@@ -524,6 +1003,22 @@ func (client *testJupyterClient) performJupyterRequest(t *testing.T, request Com
 func (client *testJupyterClient) executeCode(t *testing.T, code string) (map[string]interface{}, []ComposedMsg) {
 	t.Helper()
 
+	request := client.newExecuteRequest(t, code)
+
+	// Make the request.
+	reply, pub := client.performJupyterRequest(t, request, 10*time.Second)
+
+	// Ensure the reply is an execute_reply and extract the content from the reply.
+	assertMsgTypeEquals(t, reply, "execute_reply")
+	content := getMsgContentAsJSONObject(t, reply)
+
+	return content, pub
+}
+
+// newExecuteRequest creates an execute request for the given code.
+func (client *testJupyterClient) newExecuteRequest(t *testing.T, code string) ComposedMsg {
+	t.Helper()
+
 	// Create a message.
 	request, err := NewMsg("execute_request", ComposedMsg{})
 	if err != nil {
@@ -543,14 +1038,7 @@ func (client *testJupyterClient) executeCode(t *testing.T, code string) (map[str
 	content["silent"] = false
 	request.Content = content
 
-	// Make the request.
-	reply, pub := client.performJupyterRequest(t, request, 10*time.Second)
-
-	// Ensure the reply is an execute_reply and extract the content from the reply.
-	assertMsgTypeEquals(t, reply, "execute_reply")
-	content = getMsgContentAsJSONObject(t, reply)
-
-	return content, pub
+	return request
 }
 
 // assertMsgTypeEquals is a test helper that fails the test if the message header's MsgType is not the
@@ -621,6 +1109,30 @@ func testOutputStream(t *testing.T, codeIn string) ([]string, []string) {
 	client, closeClient := newTestJupyterClient(t)
 	defer closeClient()
 
+	return testOutputStreamFor(t, client, codeIn)
+}
+
+// testResults returns the display_data and execute_result messages among the published messages,
+// as their type followed by their text/plain representation.
+func testResults(t *testing.T, pub []ComposedMsg) []string {
+	t.Helper()
+
+	var results []string
+	for _, pubMsg := range pub {
+		switch msgType := pubMsg.Header.MsgType; msgType {
+		case "display_data", "execute_result":
+			content := getMsgContentAsJSONObject(t, pubMsg)
+			data := getJSONObject(t, "content", content, "data")
+			results = append(results, msgType+" "+getString(t, `content["data"]`, data, MIMETypeText))
+		}
+	}
+	return results
+}
+
+// testOutputStreamFor is like testOutputStream, but executes the codeIn with the given client.
+func testOutputStreamFor(t *testing.T, client testJupyterClient, codeIn string) ([]string, []string) {
+	t.Helper()
+
 	_, pub := client.executeCode(t, codeIn)
 
 	var stdout, stderr []string
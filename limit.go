@@ -0,0 +1,201 @@
+package jupyter
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// OutputLimits bounds the volume of output a single cell may publish on the IOPub channel.
+// Once a limit is exceeded, further output of the cell is suppressed and a single warning
+// is written to the stderr stream of the notebook.
+type OutputLimits struct {
+	// MaxBytes is the maximum number of bytes of stream output and rich results per cell.
+	// Zero disables the limit.
+	MaxBytes int64
+
+	// MaxMessagesPerSecond is the maximum sustained rate of output messages per cell. Short
+	// bursts of up to one second worth of messages are allowed. Zero disables the limit.
+	MaxMessagesPerSecond int
+
+	// SpillToFile writes the suppressed output to a temporary file whose path is reported in
+	// the warning.
+	SpillToFile bool
+}
+
+// DefaultOutputLimits are the output limits applied to every cell unless configured otherwise.
+var DefaultOutputLimits = OutputLimits{
+	MaxBytes:             16 << 20,
+	MaxMessagesPerSecond: 1000,
+}
+
+// outputLimiter enforces OutputLimits for the output of a single cell, including the output
+// that goroutines of the cell write after it finished. A nil *outputLimiter allows everything.
+type outputLimiter struct {
+	limits  OutputLimits
+	receipt *msgReceipt
+	logger  *slog.Logger
+
+	mu      sync.Mutex
+	bytes   int64
+	tokens  float64
+	last    time.Time
+	tripped bool
+	closed  bool
+	spill   *os.File
+}
+
+// newOutputLimiter creates an outputLimiter publishing its warning in reply to `receipt`.
+func newOutputLimiter(limits OutputLimits, receipt *msgReceipt, logger *slog.Logger) *outputLimiter {
+	return &outputLimiter{
+		limits:  limits,
+		receipt: receipt,
+		logger:  logger,
+		tokens:  float64(limits.MaxMessagesPerSecond),
+		last:    time.Now(),
+	}
+}
+
+// reserve accounts for a message of `n` bytes and returns how many of those bytes may be
+// published. A result smaller than `n` means the limit was reached and the rest must be spilled.
+func (l *outputLimiter) reserve(n int) int {
+	if l == nil {
+		return n
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.tripped {
+		return 0
+	}
+
+	if rate := float64(l.limits.MaxMessagesPerSecond); rate > 0 {
+		now := time.Now()
+		l.tokens += now.Sub(l.last).Seconds() * rate
+		if l.tokens > rate {
+			l.tokens = rate
+		}
+		l.last = now
+
+		if l.tokens < 1 {
+			l.tripLocked(fmt.Sprintf("the limit of %d messages per second", l.limits.MaxMessagesPerSecond))
+			return 0
+		}
+		l.tokens--
+	}
+
+	if max := l.limits.MaxBytes; max > 0 && l.bytes+int64(n) > max {
+		allowed := int(max - l.bytes)
+		l.bytes = max
+		l.tripLocked(fmt.Sprintf("the limit of %d bytes", max))
+		return allowed
+	}
+	l.bytes += int64(n)
+
+	return n
+}
+
+// reserveString is like reserve, but never splits a UTF-8 sequence. It returns the part of
+// `data` that may be published and spills the remainder.
+func (l *outputLimiter) reserveString(data string) string {
+	n := l.reserve(len(data))
+	if n == len(data) {
+		return data
+	}
+	for n > 0 && !utf8.RuneStart(data[n]) {
+		n--
+	}
+	l.spillString(data[n:])
+	return data[:n]
+}
+
+// reserveData accounts for a rich result and reports whether it may be published. A
+// suppressed result has its text representation spilled.
+func (l *outputLimiter) reserveData(data Data) bool {
+	n := dataSize(data)
+	if l.reserve(n) == n {
+		return true
+	}
+	if text, ok := data.Data[MIMETypeText].(string); ok {
+		l.spillString(text + "\n")
+	}
+	return false
+}
+
+// tripLocked marks the limit as exceeded and publishes the warning. The caller must hold `mu`.
+func (l *outputLimiter) tripLocked(limit string) {
+	l.tripped = true
+
+	warning := fmt.Sprintf("\nOutput of this cell exceeded %s; further output is suppressed.\n", limit)
+	if l.limits.SpillToFile && !l.closed {
+		spill, err := os.CreateTemp("", "jupyter-output-*.txt")
+		if err != nil {
+			l.logger.Error("creating output spill file", "err", err)
+		} else {
+			l.spill = spill
+			warning += fmt.Sprintf("The remaining output is written to %s\n", spill.Name())
+		}
+	}
+
+	if err := l.receipt.PublishWriteStream(StreamStderr, warning); err != nil {
+		l.logger.Error("publishing output limit warning", "err", err)
+	}
+}
+
+// spillString writes suppressed output to the spill file, if there is one.
+func (l *outputLimiter) spillString(data string) {
+	if l == nil || data == "" {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.spill == nil {
+		return
+	}
+	if _, err := l.spill.WriteString(data); err != nil {
+		l.logger.Error("writing output spill file", "err", err)
+	}
+}
+
+// Close closes the spill file when the cell finished. Output written later still counts against
+// the limits of the cell, but is no longer spilled.
+func (l *outputLimiter) Close() error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.closed = true
+	if l.spill == nil {
+		return nil
+	}
+	err := l.spill.Close()
+	l.spill = nil
+	return err
+}
+
+// dataSize estimates the number of bytes a rich result occupies on the wire.
+func dataSize(data Data) int {
+	n := 0
+	for _, v := range data.Data {
+		switch v := v.(type) {
+		case string:
+			n += len(v)
+		case []byte:
+			n += len(v)
+		default:
+			b, _ := json.Marshal(v)
+			n += len(b)
+		}
+	}
+	return n
+}
@@ -0,0 +1,122 @@
+package jupyter
+
+import (
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// spillPath finds the path of the spill file in an output limit warning.
+var spillPath = regexp.MustCompile(`written to (\S+)`)
+
+// TestOutputLimitBytes tests that the output of a cell is truncated once it exceeds the maximum number
+// of bytes, with a warning on stderr.
+func TestOutputLimitBytes(t *testing.T) {
+	_, client := startTestKernel(t, WithOutputLimits(OutputLimits{MaxBytes: 10}))
+
+	stdout, stderr := testOutputStreamFor(t, client, `ctxprint("0123456789abcdef")`)
+
+	if strings.Join(stdout, "") != "0123456789" {
+		t.Fatalf("\t%s Expected the output to be truncated but got %q", failure, stdout)
+	}
+	if len(stderr) != 1 || !strings.Contains(stderr[0], "exceeded the limit of 10 bytes") {
+		t.Fatalf("\t%s Unexpected warning %q", failure, stderr)
+	}
+	t.Logf("\t%s Output was truncated at the byte limit.", success)
+}
+
+// TestOutputLimitRate tests that the output of a cell is suppressed once it exceeds the maximum rate of
+// messages, with a warning on stderr.
+func TestOutputLimitRate(t *testing.T) {
+	_, client := startTestKernel(t, WithOutputLimits(OutputLimits{MaxMessagesPerSecond: 1}))
+
+	stdout, stderr := testOutputStreamFor(t, client, strings.Join([]string{
+		`ctxprint("a\n")`,
+		`sleep("300ms")`,
+		`ctxprint("b\n")`,
+	}, "\n"))
+
+	if len(stdout) != 1 || stdout[0] != "a\n" {
+		t.Fatalf("\t%s Expected the second message to be suppressed but got %q", failure, stdout)
+	}
+	if len(stderr) != 1 || !strings.Contains(stderr[0], "exceeded the limit of 1 messages per second") {
+		t.Fatalf("\t%s Unexpected warning %q", failure, stderr)
+	}
+	t.Logf("\t%s Output was suppressed at the rate limit.", success)
+}
+
+// TestOutputLimitSpill tests that the output suppressed by a limit is written to the spill file named in
+// the warning.
+func TestOutputLimitSpill(t *testing.T) {
+	_, client := startTestKernel(t, WithOutputLimits(OutputLimits{MaxBytes: 4, SpillToFile: true}))
+
+	stdout, stderr := testOutputStreamFor(t, client, `ctxprint("abcd")`+"\n"+`sleep("300ms")`+"\n"+`ctxprint("efgh")`)
+
+	if strings.Join(stdout, "") != "abcd" {
+		t.Fatalf("\t%s Expected the output to be truncated but got %q", failure, stdout)
+	}
+	match := spillPath.FindStringSubmatch(strings.Join(stderr, ""))
+	if match == nil {
+		t.Fatalf("\t%s Warning %q does not name a spill file", failure, stderr)
+	}
+	defer os.Remove(match[1])
+
+	spilled, err := os.ReadFile(match[1])
+	if err != nil {
+		t.Fatalf("\t%s Reading the spill file: %v", failure, err)
+	}
+	if string(spilled) != "efgh" {
+		t.Fatalf("\t%s Unexpected spilled output %q", failure, spilled)
+	}
+	t.Logf("\t%s Suppressed output was written to the spill file.", success)
+}
+
+// TestOutputLimitLateWrite tests that output written by a goroutine after its cell finished still counts
+// against the limits of the cell.
+func TestOutputLimitLateWrite(t *testing.T) {
+	_, client := startTestKernel(t, WithOutputLimits(OutputLimits{MaxBytes: 4}))
+
+	stdout, stderr := testOutputStreamFor(t, client, `ctxprint("ab")`+"\n"+`after("300ms", ctxprint("cdefgh"))`)
+	if strings.Join(stdout, "") != "ab" || len(stderr) != 0 {
+		t.Fatalf("\t%s Unexpected output %q %q", failure, stdout, stderr)
+	}
+
+	var late, warning string
+	for late == "" || warning == "" {
+		msg := client.recvIOSub(t, 2*time.Second)
+		assertMsgTypeEquals(t, msg, "stream")
+
+		content := getMsgContentAsJSONObject(t, msg)
+		if getString(t, "content", content, "name") == StreamStderr {
+			warning = getString(t, "content", content, "text")
+		} else {
+			late += getString(t, "content", content, "text")
+		}
+	}
+	if late != "cd" || !strings.Contains(warning, "exceeded the limit of 4 bytes") {
+		t.Fatalf("\t%s Unexpected late output %q and warning %q", failure, late, warning)
+	}
+	t.Logf("\t%s Late output was truncated at the limit of the cell.", success)
+}
+
+// TestOutputLimitResult tests that the result of a cell is published even when the values displayed
+// before it exceed the limits, and is replaced by a placeholder when it exceeds them itself.
+func TestOutputLimitResult(t *testing.T) {
+	_, client := startTestKernel(t, WithOutputLimits(OutputLimits{MaxBytes: 10}))
+
+	_, pub := client.executeCode(t, `value("0123456789")`+"\n"+`value("abc")`)
+	expected := []string{"execute_result abc"}
+	if results := testResults(t, pub); !reflect.DeepEqual(results, expected) {
+		t.Fatalf("\t%s Unexpected results %q, expected %q", failure, results, expected)
+	}
+
+	_, pub = client.executeCode(t, `value("0123456789abc")`)
+	expected = []string{"execute_result " + suppressedResult}
+	if results := testResults(t, pub); !reflect.DeepEqual(results, expected) {
+		t.Fatalf("\t%s Unexpected results %q, expected %q", failure, results, expected)
+	}
+	t.Logf("\t%s The result of the cell was published.", success)
+}
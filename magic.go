@@ -0,0 +1,409 @@
+package jupyter
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"unicode"
+)
+
+// MagicContext is passed to magic functions. It embeds the ExecutionContext of the cell the magic
+// runs in.
+type MagicContext struct {
+	*ExecutionContext
+
+	// Kernel is the kernel running the magic.
+	Kernel *Kernel
+
+	// Name is the name of the magic, without the leading `%` or `%%`.
+	Name string
+
+	// Line is the unparsed argument string following the name.
+	Line string
+}
+
+// LineMagicFunc implements a line magic, `%name args...`. The returned values are handled like
+// the values returned by Interpreter.Eval.
+type LineMagicFunc func(mc *MagicContext, args []string) ([]any, error)
+
+// CellMagicFunc implements a cell magic, `%%name args...`, whose body is the rest of the cell.
+type CellMagicFunc func(mc *MagicContext, args []string, body string) ([]any, error)
+
+// Magic describes a magic command. A magic may be usable as a line magic, a cell magic or both.
+type Magic struct {
+	// Name is the name of the magic, without the leading `%` or `%%`.
+	Name string
+
+	// Usage shows the arguments of the magic, for example "[-a] path".
+	Usage string
+
+	// Help is a one-line description of the magic.
+	Help string
+
+	// Line implements `%name`. Nil if the magic is not a line magic.
+	Line LineMagicFunc
+
+	// Cell implements `%%name`. Nil if the magic is not a cell magic.
+	Cell CellMagicFunc
+
+	// Complete completes the arguments of the magic. If nil, they are completed as paths.
+	Complete MagicCompleter
+}
+
+// MagicCompleter returns the completions of `word`, the partial argument of a magic before the
+// cursor. The completions replace the whole word.
+type MagicCompleter func(kernel *Kernel, word string) []string
+
+// MagicRegistry holds the magic commands of a Kernel.
+type MagicRegistry struct {
+	mu     sync.RWMutex
+	magics map[string]Magic
+}
+
+// NewMagicRegistry creates an empty MagicRegistry.
+func NewMagicRegistry() *MagicRegistry {
+	return &MagicRegistry{magics: make(map[string]Magic)}
+}
+
+// Register adds `m` to the registry, replacing a magic of the same name.
+func (r *MagicRegistry) Register(m Magic) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.magics[m.Name] = m
+}
+
+// RegisterLine adds the line magic `%name`, keeping a cell magic of the same name.
+func (r *MagicRegistry) RegisterLine(name, usage, help string, fn LineMagicFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m := r.magics[name]
+	m.Name, m.Usage, m.Help, m.Line = name, usage, help, fn
+	r.magics[name] = m
+}
+
+// RegisterCell adds the cell magic `%%name`, keeping a line magic of the same name.
+func (r *MagicRegistry) RegisterCell(name, usage, help string, fn CellMagicFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m := r.magics[name]
+	m.Name, m.Usage, m.Help, m.Cell = name, usage, help, fn
+	r.magics[name] = m
+}
+
+// SetCompleter sets the completion of the arguments of the magic `name`.
+func (r *MagicRegistry) SetCompleter(name string, fn MagicCompleter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if m, ok := r.magics[name]; ok {
+		m.Complete = fn
+		r.magics[name] = m
+	}
+}
+
+// Unregister removes the magic `name`.
+func (r *MagicRegistry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.magics, name)
+}
+
+// Lookup returns the magic `name`.
+func (r *MagicRegistry) Lookup(name string) (Magic, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	m, ok := r.magics[name]
+	return m, ok
+}
+
+// Magics returns all registered magics, sorted by name.
+func (r *MagicRegistry) Magics() []Magic {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	magics := make([]Magic, 0, len(r.magics))
+	for _, m := range r.magics {
+		magics = append(magics, m)
+	}
+	sort.Slice(magics, func(i, j int) bool { return magics[i].Name < magics[j].Name })
+	return magics
+}
+
+// LineMagics returns the names of all line magics, sorted.
+func (r *MagicRegistry) LineMagics() []string {
+	var names []string
+	for _, m := range r.Magics() {
+		if m.Line != nil {
+			names = append(names, m.Name)
+		}
+	}
+	return names
+}
+
+// CellMagics returns the names of all cell magics, sorted.
+func (r *MagicRegistry) CellMagics() []string {
+	var names []string
+	for _, m := range r.Magics() {
+		if m.Cell != nil {
+			names = append(names, m.Name)
+		}
+	}
+	return names
+}
+
+// Help returns the help text listing all magics with their usage and description.
+func (r *MagicRegistry) Help() string {
+	var buf strings.Builder
+	w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(w, "\navailable special commands (%):")
+	for _, m := range r.Magics() {
+		if m.Line != nil {
+			fmt.Fprintf(w, "%s\t%s\n", usageLine("%"+m.Name, m.Usage), m.Help)
+		}
+	}
+
+	if names := r.CellMagics(); len(names) != 0 {
+		fmt.Fprintln(w, "\navailable cell magics (%%), taking the rest of the cell as body:")
+		for _, m := range r.Magics() {
+			if m.Cell != nil {
+				fmt.Fprintf(w, "%s\t%s\n", usageLine("%%"+m.Name, m.Usage), m.Help)
+			}
+		}
+	}
+
+	w.Flush()
+	return buf.String()
+}
+
+// usageLine joins the invocation of a magic with its usage.
+func usageLine(invocation, usage string) string {
+	if usage == "" {
+		return invocation
+	}
+	return invocation + " " + usage
+}
+
+// shellHelp is appended to the help text when shell escapes are enabled.
+const shellHelp string = `
+execute shell commands ($/!) with the shell of the kernel: $command [args...]
+example:
+$ls *.go | wc -l
+
+a line starting with ! that is also code using only variables of the interpreter, like !ok, is
+code: use $ or !! to run it as a command. If the interpreter supports it, {name} and $name are
+replaced by the value of a variable, and name = !command or name = !!command assigns the output
+lines of a command to a variable.
+`
+
+// helpText returns the output of `%help`.
+func (kernel *Kernel) helpText() string {
+	if kernel.opts.HelpText != "" {
+		return kernel.opts.HelpText
+	}
+	help := kernel.magics.Help()
+	if kernel.opts.ShellEscapes {
+		help += shellHelp
+	}
+	return help
+}
+
+// cutCellMagic splits a cell starting with a `%%` line into that line and the rest of the cell.
+func cutCellMagic(code string) (line, body string, ok bool) {
+	trimmed := strings.TrimLeftFunc(code, unicode.IsSpace)
+	if !strings.HasPrefix(trimmed, "%%") {
+		return "", "", false
+	}
+	line, body, _ = strings.Cut(trimmed, "\n")
+	return strings.TrimSpace(line), body, true
+}
+
+// evalLineMagic runs a line magic. line must start with '%'.
+func (kernel *Kernel) evalLineMagic(ec *ExecutionContext, line string) ([]any, error) {
+	mc, args, err := kernel.newMagicContext(ec, line[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	m, ok := kernel.magics.Lookup(mc.Name)
+	if !ok || m.Line == nil {
+		return nil, fmt.Errorf("unknown special command: %q\n%s", line, kernel.helpText())
+	}
+	return m.Line(mc, args)
+}
+
+// evalCellMagic runs a cell magic. line must start with '%%'.
+func (kernel *Kernel) evalCellMagic(ec *ExecutionContext, line, body string) ([]any, error) {
+	mc, args, err := kernel.newMagicContext(ec, line[2:])
+	if err != nil {
+		return nil, err
+	}
+
+	m, ok := kernel.magics.Lookup(mc.Name)
+	if !ok || m.Cell == nil {
+		return nil, fmt.Errorf("unknown cell magic: %q\n%s", line, kernel.helpText())
+	}
+	return m.Cell(mc, args, body)
+}
+
+// newMagicContext parses the name and arguments of a magic invocation without its `%` prefix.
+func (kernel *Kernel) newMagicContext(ec *ExecutionContext, invocation string) (*MagicContext, []string, error) {
+	name, rest := invocation, ""
+	if i := strings.IndexFunc(invocation, unicode.IsSpace); i >= 0 {
+		name, rest = invocation[:i], strings.TrimSpace(invocation[i:])
+	}
+
+	args, err := splitArgs(rest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%%%s: %w", name, err)
+	}
+
+	return &MagicContext{
+		ExecutionContext: ec,
+		Kernel:           kernel,
+		Name:             name,
+		Line:             rest,
+	}, args, nil
+}
+
+// errUnterminatedQuote is returned by splitArgs for an argument string with an open quote.
+var errUnterminatedQuote = errors.New("unterminated quote in arguments")
+
+// splitArgs splits an argument string into words like a POSIX shell does, without expansions:
+// words are separated by blanks, single quotes preserve everything literally, double quotes
+// allow backslash escapes of `"`, `\`, `$` and "`", and a backslash outside quotes escapes the
+// next character.
+func splitArgs(s string) ([]string, error) {
+	var (
+		args   []string
+		word   strings.Builder
+		inWord bool
+	)
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case c == '\\':
+			inWord = true
+			if i+1 < len(s) {
+				i++
+				word.WriteByte(s[i])
+			}
+		case c == '\'':
+			inWord = true
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, errUnterminatedQuote
+			}
+			word.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+		case c == '"':
+			inWord = true
+			closed := false
+			for i++; i < len(s); i++ {
+				if s[i] == '"' {
+					closed = true
+					break
+				}
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("\"\\$`", s[i+1]) >= 0 {
+					i++
+				}
+				word.WriteByte(s[i])
+			}
+			if !closed {
+				return nil, errUnterminatedQuote
+			}
+		default:
+			inWord = true
+			word.WriteByte(c)
+		}
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
+
+// registerBuiltinMagics adds the magics every kernel provides.
+func (kernel *Kernel) registerBuiltinMagics() {
+	kernel.magics.RegisterLine("cd", "[path]", "change the working directory of the kernel", magicCd)
+	kernel.magics.RegisterLine("help", "", "show this help", magicHelp)
+	kernel.magics.RegisterLine("lsmagic", "", "list the available magics", magicLsmagic)
+	kernel.magics.SetCompleter("cd", CompleteDirectories)
+	kernel.magics.SetCompleter("help", CompleteNothing)
+	kernel.magics.SetCompleter("lsmagic", CompleteNothing)
+	kernel.registerDisplayMagics()
+	kernel.registerFileMagics()
+	kernel.registerTimeMagics()
+	kernel.registerResourceMagics()
+	kernel.registerEnvMagics()
+	kernel.registerShellMagics()
+}
+
+// magicCd implements `%cd [path]`. Without a path it changes to the home directory.
+func magicCd(mc *MagicContext, args []string) ([]any, error) {
+	if len(args) > 1 {
+		return nil, fmt.Errorf("%%cd: too many arguments")
+	}
+
+	arg := ""
+	if len(args) == 1 {
+		arg = args[0]
+	}
+	if arg == "" && mc.Kernel.opts.Policy.RootDir != "" {
+		arg = mc.Kernel.opts.Policy.RootDir
+	} else if arg == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("error getting user home directory: %v", err)
+		}
+		arg = home
+	}
+
+	dir := mc.resolvePath(arg)
+	if err := mc.Kernel.opts.Policy.checkPath(dir); err != nil {
+		return nil, fmt.Errorf("%%cd: %w", err)
+	}
+	info, err := os.Stat(dir)
+	if err == nil && !info.IsDir() {
+		err = fmt.Errorf("not a directory")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error setting current directory to %q: %v", arg, err)
+	}
+
+	mc.Kernel.dir = dir
+	mc.Dir = dir
+	return nil, nil
+}
+
+// magicHelp implements `%help`.
+func magicHelp(mc *MagicContext, args []string) ([]any, error) {
+	_, err := fmt.Fprint(mc.Stdout, mc.Kernel.helpText())
+	return nil, err
+}
+
+// magicLsmagic implements `%lsmagic`.
+func magicLsmagic(mc *MagicContext, args []string) ([]any, error) {
+	line := mc.Kernel.magics.LineMagics()
+	for i, name := range line {
+		line[i] = "%" + name
+	}
+	cell := mc.Kernel.magics.CellMagics()
+	for i, name := range cell {
+		cell[i] = "%%" + name
+	}
+
+	_, err := fmt.Fprintf(mc.Stdout, "Available line magics:\n%s\n\nAvailable cell magics:\n%s\n",
+		strings.Join(line, "  "), strings.Join(cell, "  "))
+	return nil, err
+}
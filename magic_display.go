@@ -0,0 +1,51 @@
+package jupyter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// registerDisplayMagics adds the cell magics publishing their body as display_data.
+func (kernel *Kernel) registerDisplayMagics() {
+	kernel.magics.RegisterCell("html", "", "display the cell as HTML", displayMagic(HTML))
+	kernel.magics.RegisterCell("markdown", "", "display the cell as Markdown", displayMagic(Markdown))
+	kernel.magics.RegisterCell("latex", "", "display the cell as LaTeX", displayMagic(func(latex string) Data {
+		return MakeData(MIMETypeLatex, latex)
+	}))
+	kernel.magics.RegisterCell("svg", "", "display the cell as an SVG image", displayMagic(SVG))
+	kernel.magics.RegisterCell("javascript", "", "run the cell as JavaScript in the front-end", displayMagic(JavaScript))
+	kernel.magics.RegisterCell("json", "", "validate the cell as JSON and display it", magicJSON)
+	for _, name := range []string{"html", "markdown", "latex", "svg", "javascript", "json"} {
+		kernel.magics.SetCompleter(name, CompleteNothing)
+	}
+}
+
+// displayMagic returns a cell magic publishing the body as the Data returned by `render`.
+func displayMagic(render func(body string) Data) CellMagicFunc {
+	return func(mc *MagicContext, args []string, body string) ([]any, error) {
+		if len(args) != 0 {
+			return nil, fmt.Errorf("%%%%%s: unexpected arguments %q", mc.Name, args)
+		}
+		return nil, mc.Display(render(body))
+	}
+}
+
+// magicJSON implements `%%json`.
+func magicJSON(mc *MagicContext, args []string, body string) ([]any, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf("%%%%json: unexpected arguments %q", args)
+	}
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(body), &value); err != nil {
+		return nil, fmt.Errorf("%%%%json: invalid JSON: %v", err)
+	}
+
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, []byte(body), "", "  "); err != nil {
+		return nil, fmt.Errorf("%%%%json: invalid JSON: %v", err)
+	}
+
+	return nil, mc.Display(MakeData3(MIMETypeJSON, pretty.String(), value))
+}
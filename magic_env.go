@@ -0,0 +1,180 @@
+package jupyter
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// registerEnvMagics adds the magics managing environment variables. The environment belongs to
+// the kernel: it applies to shell commands and is available to the interpreter as
+// ExecutionContext.Env, but the environment of the process is left unchanged.
+func (kernel *Kernel) registerEnvMagics() {
+	kernel.magics.RegisterLine("env", "[NAME[=value]]", "list, get or set environment variables", magicEnv)
+	kernel.magics.RegisterCell("env", "", "set the environment variables assigned in the cell, one NAME=value per line", magicCellEnv)
+	kernel.magics.SetCompleter("env", completeEnvNames)
+}
+
+// secretEnvPatterns are substrings of the names of environment variables whose values are masked
+// when listed.
+var secretEnvPatterns = []string{"SECRET", "TOKEN", "PASSWORD", "PASSWD", "KEY", "CREDENTIAL", "AUTH", "PRIVATE"}
+
+// maskedEnvValue replaces the value of secret-like environment variables.
+const maskedEnvValue = "********"
+
+// isSecretEnv reports whether the value of the environment variable `name` should be masked.
+func isSecretEnv(name string) bool {
+	name = strings.ToUpper(name)
+	for _, pattern := range secretEnvPatterns {
+		if strings.Contains(name, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// maskEnv returns `value`, or a mask if `name` looks like the name of a secret.
+func maskEnv(name, value string) string {
+	if isSecretEnv(name) && value != "" {
+		return maskedEnvValue
+	}
+	return value
+}
+
+// completeEnvNames completes the names of environment variables.
+func completeEnvNames(kernel *Kernel, word string) []string {
+	var names []string
+	for _, kv := range kernel.env {
+		if name, _, _ := strings.Cut(kv, "="); strings.HasPrefix(name, word) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// magicEnv implements `%env`, `%env NAME`, `%env NAME=value` and `%env NAME value`.
+func magicEnv(mc *MagicContext, args []string) ([]any, error) {
+	line := mc.Line
+	if line == "" {
+		env := slices.Clone(mc.Env)
+		sort.Strings(env)
+		for _, kv := range env {
+			name, value, _ := strings.Cut(kv, "=")
+			if _, err := fmt.Fprintf(mc.Stdout, "%s=%s\n", name, maskEnv(name, value)); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	}
+
+	name, value, assign := strings.Cut(line, "=")
+	if !assign && len(args) == 2 {
+		name, value, assign = args[0], args[1], true
+	} else if !assign && len(args) != 1 {
+		return nil, fmt.Errorf("usage: %%env [NAME[=value]]")
+	}
+	name = strings.TrimSpace(name)
+
+	if !assign {
+		value, ok := lookupEnv(mc.Env, name)
+		if !ok {
+			return nil, fmt.Errorf("%%env: environment variable %s is not set", name)
+		}
+		_, err := fmt.Fprintln(mc.Stdout, value)
+		return nil, err
+	}
+
+	value, err := unquoteEnvValue(value)
+	if err != nil {
+		return nil, fmt.Errorf("%%env: %w", err)
+	}
+	return nil, setEnv(mc, name, value)
+}
+
+// magicCellEnv implements `%%env`. The body is read like a `.env` file: lines are `NAME=value`,
+// optionally preceded by `export`; blank lines and lines starting with `#` are skipped, and values
+// may be quoted.
+func magicCellEnv(mc *MagicContext, args []string, body string) ([]any, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf("%%%%env: unexpected arguments %q", args)
+	}
+
+	for i, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%%%%env: line %d: expected NAME=value, got %q", i+1, line)
+		}
+		value, err := unquoteEnvValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("%%%%env: line %d: %w", i+1, err)
+		}
+		if err := setEnv(mc, strings.TrimSpace(name), value); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// unquoteEnvValue returns the value of an assignment. Quoted values are unquoted like shell words;
+// unquoted values end at a ` #` comment.
+func unquoteEnvValue(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || (value[0] != '"' && value[0] != '\'') {
+		if i := strings.Index(value, " #"); i >= 0 {
+			value = strings.TrimSpace(value[:i])
+		}
+		return value, nil
+	}
+
+	words, err := splitArgs(value)
+	if err != nil {
+		return "", err
+	}
+	if len(words) != 1 {
+		return "", fmt.Errorf("unexpected text after quoted value %q", value)
+	}
+	return words[0], nil
+}
+
+// setEnv sets the environment variable `name` of the kernel and reports it.
+func setEnv(mc *MagicContext, name, value string) error {
+	if name == "" || strings.ContainsAny(name, " \t=") {
+		return fmt.Errorf("%%env: invalid variable name %q", name)
+	}
+	if err := mc.Kernel.opts.Policy.checkEnv(name); err != nil {
+		return fmt.Errorf("%%env: %w", err)
+	}
+	mc.Kernel.env = withEnv(mc.Env, name, value)
+	mc.Env = mc.Kernel.env
+	_, err := fmt.Fprintf(mc.Stdout, "env: %s=%s\n", name, maskEnv(name, value))
+	return err
+}
+
+// lookupEnv returns the value of the variable `name` in `env`, like os.LookupEnv.
+func lookupEnv(env []string, name string) (string, bool) {
+	for i := len(env) - 1; i >= 0; i-- {
+		if value, ok := strings.CutPrefix(env[i], name+"="); ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// withEnv returns a copy of `env` with the variable `name` set to `value`.
+func withEnv(env []string, name, value string) []string {
+	result := make([]string, 0, len(env)+1)
+	for _, kv := range env {
+		if !strings.HasPrefix(kv, name+"=") {
+			result = append(result, kv)
+		}
+	}
+	return append(result, name+"="+value)
+}
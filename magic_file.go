@@ -0,0 +1,106 @@
+package jupyter
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// registerFileMagics adds the magics reading and writing files.
+func (kernel *Kernel) registerFileMagics() {
+	kernel.magics.RegisterCell("writefile", "[-a] path", "write the cell to a file, or append it with -a", magicWritefile)
+	kernel.magics.RegisterLine("load", "path", "replace the cell with the contents of a file", magicLoad)
+	kernel.magics.RegisterLine("run", "path", "run a file as if it were a cell", magicRun)
+}
+
+// magicWritefile implements `%%writefile [-a] path`.
+func magicWritefile(mc *MagicContext, args []string, body string) ([]any, error) {
+	appendMode := false
+	if len(args) != 0 && (args[0] == "-a" || args[0] == "--append") {
+		appendMode = true
+		args = args[1:]
+	}
+	if len(args) != 1 {
+		return nil, fmt.Errorf("usage: %%%%writefile [-a] path")
+	}
+
+	path := mc.resolvePath(args[0])
+	if err := mc.Kernel.opts.Policy.checkPath(path); err != nil {
+		return nil, fmt.Errorf("%%%%writefile: %w", err)
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	action := "Writing"
+	if appendMode {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		action = "Appending to"
+	} else if _, err := os.Stat(path); err == nil {
+		action = "Overwriting"
+	}
+
+	f, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("%%%%writefile: %v", err)
+	}
+	_, err = f.WriteString(body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%%%%writefile: %v", err)
+	}
+
+	_, err = fmt.Fprintf(mc.Stdout, "%s %s\n", action, args[0])
+	return nil, err
+}
+
+// magicLoad implements `%load path`. The contents of the file replace the cell in the front-end,
+// preceded by the magic as a line comment of the language, if it has line comments.
+func magicLoad(mc *MagicContext, args []string) ([]any, error) {
+	src, err := readMagicFile("load", mc, args)
+	if err != nil {
+		return nil, err
+	}
+	if comments := mc.Kernel.syntax().LineComments; len(comments) != 0 {
+		src = comments[0] + " %load " + mc.Line + "\n" + src
+	}
+	mc.SetNextInput(src, true)
+	return nil, nil
+}
+
+// magicRun implements `%run path`. The file is evaluated like a cell, including its special
+// commands, and its values are the values of the magic. A file that runs itself, directly or
+// through other files, is an error.
+func magicRun(mc *MagicContext, args []string) ([]any, error) {
+	src, err := readMagicFile("run", mc, args)
+	if err != nil {
+		return nil, err
+	}
+
+	path := mc.resolvePath(args[0])
+	if slices.Contains(mc.running, path) {
+		return nil, fmt.Errorf("%%run: %q runs itself", args[0])
+	}
+	mc.running = append(mc.running, path)
+	defer func() { mc.running = mc.running[:len(mc.running)-1] }()
+
+	return mc.Kernel.evalCode(mc.ExecutionContext, src)
+}
+
+// readMagicFile reads the file named by the single argument of the magic `name`.
+func readMagicFile(name string, mc *MagicContext, args []string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("usage: %%%s path", name)
+	}
+	path := mc.resolvePath(args[0])
+	if err := mc.Kernel.opts.Policy.checkPath(path); err != nil {
+		return "", fmt.Errorf("%%%s: %w", name, err)
+	}
+	src, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("%%%s: file %q not found", name, args[0])
+	} else if err != nil {
+		return "", fmt.Errorf("%%%s: %v", name, err)
+	}
+	return string(src), nil
+}
@@ -0,0 +1,11 @@
+package jupyter
+
+// registerShellMagics adds the cell magics running the cell as a shell script.
+func (kernel *Kernel) registerShellMagics() {
+	kernel.magics.RegisterCell("sh", "[args...]", "run the cell with the shell of the kernel", func(mc *MagicContext, args []string, body string) ([]any, error) {
+		return nil, mc.Kernel.runShell(mc.ExecutionContext, mc.Kernel.opts.Shell, body, args...)
+	})
+	kernel.magics.RegisterCell("bash", "[args...]", "run the cell with bash", func(mc *MagicContext, args []string, body string) ([]any, error) {
+		return nil, mc.Kernel.runShell(mc.ExecutionContext, "bash", body, args...)
+	})
+}
@@ -0,0 +1,348 @@
+package jupyter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSplitArgs tests the quoting rules of magic arguments.
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{``, nil},
+		{`a b  c`, []string{"a", "b", "c"}},
+		{`'a b' c`, []string{"a b", "c"}},
+		{`"a \"b\"" '\n'`, []string{`a "b"`, `\n`}},
+		{`a\ b c\\`, []string{"a b", `c\`}},
+		{`x"y z"'w'`, []string{"xy zw"}},
+		{`'' ""`, []string{"", ""}},
+	}
+
+	for _, test := range tests {
+		got, err := splitArgs(test.input)
+		if err != nil {
+			t.Fatalf("\t%s splitArgs(%q): %s", failure, test.input, err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Fatalf("\t%s splitArgs(%q) = %q, want %q", failure, test.input, got, test.want)
+		}
+	}
+
+	for _, input := range []string{`'a`, `"a`, `"a\"`} {
+		if _, err := splitArgs(input); err != errUnterminatedQuote {
+			t.Fatalf("\t%s splitArgs(%q) returned %v, want errUnterminatedQuote", failure, input, err)
+		}
+	}
+	t.Logf("\t%s Arguments were split.", success)
+}
+
+// TestMagicRegistry tests that magics registered by the user are run and listed.
+func TestMagicRegistry(t *testing.T) {
+	kernel, client := startTestKernel(t)
+
+	kernel.Magics().RegisterLine("greet", "name", "greet someone", func(mc *MagicContext, args []string) ([]any, error) {
+		fmt.Fprintf(mc.Stdout, "hello %s\n", strings.Join(args, "|"))
+		return nil, nil
+	})
+	kernel.Magics().RegisterCell("upper", "", "print the body in upper case", func(mc *MagicContext, args []string, body string) ([]any, error) {
+		fmt.Fprint(mc.Stdout, strings.ToUpper(body))
+		return nil, nil
+	})
+
+	stdout, _ := testOutputStreamFor(t, client, "%greet 'big world' x\nctxprint(\"done\\n\")")
+	if strings.Join(stdout, "") != "hello big world|x\ndone\n" {
+		t.Fatalf("\t%s Unexpected output of line magic %q", failure, stdout)
+	}
+
+	stdout, _ = testOutputStreamFor(t, client, "%%upper\nabc\n")
+	if strings.Join(stdout, "") != "ABC\n" {
+		t.Fatalf("\t%s Unexpected output of cell magic %q", failure, stdout)
+	}
+
+	stdout, _ = testOutputStreamFor(t, client, "%lsmagic")
+	if out := strings.Join(stdout, ""); !strings.Contains(out, "%greet") || !strings.Contains(out, "%%upper") {
+		t.Fatalf("\t%s %%lsmagic does not list the registered magics: %q", failure, out)
+	}
+
+	stdout, _ = testOutputStreamFor(t, client, "%help")
+	if out := strings.Join(stdout, ""); !strings.Contains(out, "%greet name") || !strings.Contains(out, "greet someone") {
+		t.Fatalf("\t%s %%help does not describe the registered magics: %q", failure, out)
+	}
+
+	content, _ := client.executeCode(t, "%nosuchmagic")
+	if status := getString(t, "content", content, "status"); status != "error" {
+		t.Fatalf("\t%s Expected an unknown magic to fail", failure)
+	}
+	t.Logf("\t%s Registered magics were run.", success)
+}
+
+// TestCompleteMagic tests the completion of magic names.
+func TestCompleteMagic(t *testing.T) {
+	kernel, client := startTestKernel(t)
+	kernel.Magics().RegisterCell("upper", "", "", func(mc *MagicContext, args []string, body string) ([]any, error) {
+		return nil, nil
+	})
+
+	tests := []struct {
+		code  string
+		start int
+		want  []string
+	}{
+		{"%ls", 0, []string{"%lsmagic"}},
+		{"x := 1\n  %c", 9, []string{"%cd"}},
+		{"%%u", 0, []string{"%%upper"}},
+	}
+
+	for _, test := range tests {
+		content := client.completeCode(t, test.code, len([]rune(test.code)))
+		if status := getString(t, "content", content, "status"); status != "ok" {
+			t.Fatalf("\t%s Completion of %q failed", failure, test.code)
+		}
+		var matches []string
+		for _, m := range content["matches"].([]interface{}) {
+			matches = append(matches, m.(string))
+		}
+		if !reflect.DeepEqual(matches, test.want) || int(content["cursor_start"].(float64)) != test.start {
+			t.Fatalf("\t%s Completion of %q returned %q at %v", failure, test.code, matches, content["cursor_start"])
+		}
+	}
+	t.Logf("\t%s Magic names were completed.", success)
+}
+
+// completeCode performs a complete_request and returns the content of the reply.
+func (client *testJupyterClient) completeCode(t *testing.T, code string, cursorPos int) map[string]interface{} {
+	t.Helper()
+
+	request, err := NewMsg("complete_request", ComposedMsg{})
+	if err != nil {
+		t.Fatalf("\t%s NewMsg: %s", failure, err)
+	}
+	request.Header.Session = sessionID
+	request.Header.Username = "KernelTester"
+	request.Metadata = make(map[string]interface{})
+	request.Content = map[string]interface{}{
+		"code":       code,
+		"cursor_pos": cursorPos,
+	}
+
+	reply, _ := client.performJupyterRequest(t, request, 10*time.Second)
+	assertMsgTypeEquals(t, reply, "complete_reply")
+	return getMsgContentAsJSONObject(t, reply)
+}
+
+// TestDisplayMagics tests that the display cell magics publish their body as display_data.
+func TestDisplayMagics(t *testing.T) {
+	_, client := startTestKernel(t)
+
+	tests := []struct {
+		code, mimeType string
+		want           interface{}
+	}{
+		{"%%html\n<b>hi</b>", MIMETypeHTML, "<b>hi</b>"},
+		{"%%markdown\n# hi", MIMETypeMarkdown, "# hi"},
+		{"%%latex\n$x^2$", MIMETypeLatex, "$x^2$"},
+		{"%%svg\n<svg></svg>", MIMETypeSVG, "<svg></svg>"},
+		{"%%javascript\nalert(1)", MIMETypeJavaScript, "alert(1)"},
+		{"%%json\n{\"a\": [1, 2]}", MIMETypeJSON, map[string]interface{}{"a": []interface{}{1.0, 2.0}}},
+	}
+
+	for _, test := range tests {
+		content, pub := client.executeCode(t, test.code)
+		if status := getString(t, "content", content, "status"); status != "ok" {
+			t.Fatalf("\t%s Execution of %q failed", failure, test.code)
+		}
+
+		var data map[string]interface{}
+		for _, msg := range pub {
+			if msg.Header.MsgType == "display_data" {
+				data = getJSONObject(t, "content", getMsgContentAsJSONObject(t, msg), "data")
+			}
+		}
+		if !reflect.DeepEqual(data[test.mimeType], test.want) {
+			t.Fatalf("\t%s %q displayed %v", failure, test.code, data)
+		}
+	}
+
+	content, _ := client.executeCode(t, "%%json\n{\"a\": ")
+	if status := getString(t, "content", content, "status"); status != "error" {
+		t.Fatalf("\t%s Expected invalid JSON to fail", failure)
+	}
+	t.Logf("\t%s Display magics were published.", success)
+}
+
+// TestFileMagics tests %%writefile, %load and %run relative to the working directory of the kernel, and that
+// %run refuses a file that runs itself.
+func TestFileMagics(t *testing.T) {
+	_, client := startTestKernel(t)
+	dir := t.TempDir()
+
+	stdout, _ := testOutputStreamFor(t, client, fmt.Sprintf("%%cd %q", dir))
+	if len(stdout) != 0 {
+		t.Fatalf("\t%s Unexpected output of %%cd %q", failure, stdout)
+	}
+
+	stdout, _ = testOutputStreamFor(t, client, "%%writefile script.txt\nctxprint(\"one\\n\")\n")
+	if strings.Join(stdout, "") != "Writing script.txt\n" {
+		t.Fatalf("\t%s Unexpected output of %%%%writefile %q", failure, stdout)
+	}
+	stdout, _ = testOutputStreamFor(t, client, "%%writefile -a script.txt\nctxprint(\"two\\n\")\n")
+	if strings.Join(stdout, "") != "Appending to script.txt\n" {
+		t.Fatalf("\t%s Unexpected output of %%%%writefile -a %q", failure, stdout)
+	}
+
+	want := "ctxprint(\"one\\n\")\nctxprint(\"two\\n\")\n"
+	if src, err := os.ReadFile(filepath.Join(dir, "script.txt")); err != nil || string(src) != want {
+		t.Fatalf("\t%s Unexpected file contents %q: %v", failure, src, err)
+	}
+
+	content, _ := client.executeCode(t, "%load script.txt")
+	payload, _ := content["payload"].([]interface{})
+	if len(payload) != 1 {
+		t.Fatalf("\t%s Expected a set_next_input payload but got %v", failure, content["payload"])
+	}
+	next := payload[0].(map[string]interface{})
+	if next["source"] != "set_next_input" || next["text"] != "// %load script.txt\n"+want || next["replace"] != true {
+		t.Fatalf("\t%s Unexpected payload %v", failure, next)
+	}
+
+	stdout, _ = testOutputStreamFor(t, client, "%run script.txt")
+	if strings.Join(stdout, "") != "one\ntwo\n" {
+		t.Fatalf("\t%s Unexpected output of %%run %q", failure, stdout)
+	}
+
+	content, _ = client.executeCode(t, "%run missing.txt")
+	if status := getString(t, "content", content, "status"); status != "error" {
+		t.Fatalf("\t%s Expected %%run of a missing file to fail", failure)
+	}
+
+	client.executeCode(t, "%%writefile loop.txt\n%run loop.txt\n")
+	content, _ = client.executeCode(t, "%run loop.txt")
+	if evalue, _ := content["evalue"].(string); !strings.Contains(evalue, `"loop.txt" runs itself`) {
+		t.Fatalf("\t%s Expected %%run of a file running itself to fail but got %v", failure, content["evalue"])
+	}
+	t.Logf("\t%s File magics were applied.", success)
+}
+
+// TestTimeMagics tests %time, %%timeit and the timing metadata of execute_reply.
+func TestTimeMagics(t *testing.T) {
+	_, client := startTestKernel(t)
+
+	stdout, _ := testOutputStreamFor(t, client, `%time ctxprint("x\n")`)
+	if out := strings.Join(stdout, ""); !strings.HasPrefix(out, "x\n") || !strings.Contains(out, "Wall time: ") || !strings.Contains(out, "Allocations: ") {
+		t.Fatalf("\t%s Unexpected output of %%time %q", failure, out)
+	}
+
+	stdout, _ = testOutputStreamFor(t, client, "%%timeit -n 3 -r 2\nsleep(\"1ms\")")
+	if out := strings.Join(stdout, ""); !strings.Contains(out, " ms ± ") || !strings.HasSuffix(out, "per loop (mean ± std. dev. of 2 runs, 3 loops each)\n") {
+		t.Fatalf("\t%s Unexpected output of %%%%timeit %q", failure, out)
+	}
+
+	content, _ := client.executeCode(t, "%timeit -n x value(1)")
+	if status := getString(t, "content", content, "status"); status != "error" {
+		t.Fatalf("\t%s Expected an invalid loop count to fail", failure)
+	}
+
+	request := client.newExecuteRequest(t, `sleep("20ms")`)
+	reply, _ := client.performJupyterRequest(t, request, 10*time.Second)
+	if _, err := time.Parse(time.RFC3339Nano, fmt.Sprint(reply.Metadata["started"])); err != nil {
+		t.Fatalf("\t%s Unexpected started metadata: %v", failure, err)
+	}
+	if duration, _ := reply.Metadata["duration"].(float64); duration < 0.02 {
+		t.Fatalf("\t%s Unexpected duration metadata %v", failure, reply.Metadata["duration"])
+	}
+	t.Logf("\t%s Cells were timed.", success)
+}
+
+// TestFormatSeconds tests the formatting of durations by the timing magics.
+func TestFormatSeconds(t *testing.T) {
+	tests := map[float64]string{
+		1.5:      "1.5 s",
+		0.01234:  "12.3 ms",
+		2.5e-6:   "2.5 µs",
+		123e-9:   "123 ns",
+		0:        "0 ns",
+		1234.567: "1235 s",
+	}
+	for s, want := range tests {
+		if got := formatSeconds(s); got != want {
+			t.Fatalf("\t%s formatSeconds(%v) = %q, want %q", failure, s, got, want)
+		}
+	}
+	t.Logf("\t%s Durations were formatted.", success)
+}
+
+// TestEnvMagics tests that %env and %%env set the environment of the shell commands of the kernel, without
+// changing the environment of the process.
+func TestEnvMagics(t *testing.T) {
+	kernel, client := startTestKernel(t)
+
+	stdout, _ := testOutputStreamFor(t, client, "%env JUPYTER_TEST_VAR=hello world\n!printenv JUPYTER_TEST_VAR")
+	if out := strings.Join(stdout, ""); out != "env: JUPYTER_TEST_VAR=hello world\nhello world\n" {
+		t.Fatalf("\t%s Unexpected output of %%env %q", failure, out)
+	}
+
+	stdout, _ = testOutputStreamFor(t, client, "%env JUPYTER_TEST_VAR")
+	if out := strings.Join(stdout, ""); out != "hello world\n" {
+		t.Fatalf("\t%s Unexpected output of %%env NAME %q", failure, out)
+	}
+
+	stdout, _ = testOutputStreamFor(t, client, "%%env\n# comment\nexport JUPYTER_TEST_A='a b'\nJUPYTER_TEST_B=c # comment\nJUPYTER_TEST_TOKEN=\"s3cret\"\n")
+	if out := strings.Join(stdout, ""); !strings.Contains(out, "JUPYTER_TEST_TOKEN=********") || strings.Contains(out, "s3cret") {
+		t.Fatalf("\t%s Expected the token to be masked but got %q", failure, out)
+	}
+	if a, _ := lookupEnv(kernel.env, "JUPYTER_TEST_A"); a != "a b" {
+		t.Fatalf("\t%s %%%%env did not set the environment of the kernel", failure)
+	}
+	if _, ok := os.LookupEnv("JUPYTER_TEST_A"); ok {
+		t.Fatalf("\t%s %%%%env changed the environment of the process", failure)
+	}
+	stdout, _ = testOutputStreamFor(t, client, "!printenv JUPYTER_TEST_B JUPYTER_TEST_TOKEN")
+	if out := strings.Join(stdout, ""); out != "c\ns3cret\n" {
+		t.Fatalf("\t%s Unexpected environment of shell commands %q", failure, out)
+	}
+
+	stdout, _ = testOutputStreamFor(t, client, "%env")
+	out := strings.Join(stdout, "")
+	if !strings.Contains(out, "\nJUPYTER_TEST_A=a b\n") || !strings.Contains(out, "\nJUPYTER_TEST_TOKEN=********\n") {
+		t.Fatalf("\t%s Unexpected listing of the environment", failure)
+	}
+	t.Logf("\t%s The environment was managed.", success)
+}
+
+// TestShellCommands tests that shell escapes and shell cell magics run with shell semantics.
+func TestShellCommands(t *testing.T) {
+	// Without a pseudo-terminal, the stderr of commands has its own stream.
+	_, client := startTestKernel(t, WithPty(false))
+	dir := t.TempDir()
+	for _, name := range []string{"a.go", "b.go", "c.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stdout, _ := testOutputStreamFor(t, client, fmt.Sprintf("%%cd %q\n$ls *.go | wc -l && echo \"done  twice\"", dir))
+	if out := strings.Join(stdout, ""); !strings.HasPrefix(strings.TrimSpace(out), "2\n") || !strings.HasSuffix(out, "done  twice\n") {
+		t.Fatalf("\t%s Unexpected output of shell escape %q", failure, out)
+	}
+
+	content, _ := client.executeCode(t, "!echo before; exit 3")
+	if status := getString(t, "content", content, "status"); status != "error" {
+		t.Fatalf("\t%s Expected a failing command to fail the cell", failure)
+	}
+	if evalue := getString(t, "content", content, "evalue"); !strings.Contains(evalue, "exit status 3") {
+		t.Fatalf("\t%s Unexpected error %q", failure, evalue)
+	}
+
+	stdout, stderr := testOutputStreamFor(t, client, "%%sh x y\necho $2 $1\necho err >&2\n")
+	if strings.Join(stdout, "") != "y x\n" || strings.Join(stderr, "") != "err\n" {
+		t.Fatalf("\t%s Unexpected output of %%%%sh %q %q", failure, stdout, stderr)
+	}
+	t.Logf("\t%s Shell commands were run.", success)
+}
@@ -0,0 +1,209 @@
+package jupyter
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// registerTimeMagics adds the magics timing code.
+func (kernel *Kernel) registerTimeMagics() {
+	kernel.magics.RegisterLine("time", "code", "run code once and report its run time and allocations", magicTime)
+	kernel.magics.RegisterCell("time", "", "run the cell once and report its run time and allocations", func(mc *MagicContext, args []string, body string) ([]any, error) {
+		if len(args) != 0 {
+			return nil, fmt.Errorf("%%%%time: unexpected arguments %q", args)
+		}
+		return timeCode(mc, body)
+	})
+	kernel.magics.RegisterLine("timeit", "[-n loops] [-r runs] code", "measure the mean run time of code", magicTimeit)
+	kernel.magics.RegisterCell("timeit", "[-n loops] [-r runs]", "measure the mean run time of the cell", magicCellTimeit)
+	kernel.magics.SetCompleter("time", CompleteNothing)
+	kernel.magics.SetCompleter("timeit", CompleteNothing)
+}
+
+// timeitRuns is the default number of runs of `%timeit`.
+const timeitRuns = 7
+
+// timeitMinDuration is the minimum duration of a run when `%timeit` picks the number of loops.
+const timeitMinDuration = 200 * time.Millisecond
+
+// magicTime implements `%time code`.
+func magicTime(mc *MagicContext, args []string) ([]any, error) {
+	return timeCode(mc, mc.Line)
+}
+
+// timeCode evaluates code once in the interpreter and reports the time and memory it took.
+func timeCode(mc *MagicContext, code string) ([]any, error) {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	user, sys, cpuOK := cpuTime()
+	start := time.Now()
+
+	values, err := mc.Kernel.eval(mc.ExecutionContext, code)
+
+	wall := time.Since(start)
+	user2, sys2, _ := cpuTime()
+	runtime.ReadMemStats(&after)
+
+	if cpuOK {
+		user, sys = user2-user, sys2-sys
+		fmt.Fprintf(mc.Stdout, "CPU times: user %s, sys %s, total %s\n",
+			formatSeconds(user.Seconds()), formatSeconds(sys.Seconds()), formatSeconds((user + sys).Seconds()))
+	}
+	fmt.Fprintf(mc.Stdout, "Wall time: %s\n", formatSeconds(wall.Seconds()))
+	fmt.Fprintf(mc.Stdout, "Allocations: %d (%s)\n", after.Mallocs-before.Mallocs, formatBytes(after.TotalAlloc-before.TotalAlloc))
+
+	return values, err
+}
+
+// magicTimeit implements `%timeit [-n loops] [-r runs] code`.
+func magicTimeit(mc *MagicContext, args []string) ([]any, error) {
+	loops, runs, code, err := parseTimeitFlags(mc.Line)
+	if err != nil {
+		return nil, err
+	}
+	return nil, timeit(mc, code, loops, runs)
+}
+
+// magicCellTimeit implements `%%timeit [-n loops] [-r runs]`.
+func magicCellTimeit(mc *MagicContext, args []string, body string) ([]any, error) {
+	loops, runs, rest, err := parseTimeitFlags(mc.Line)
+	if err != nil {
+		return nil, err
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("%%%%timeit: unexpected arguments %q", rest)
+	}
+	return nil, timeit(mc, body, loops, runs)
+}
+
+// parseTimeitFlags parses the leading -n and -r options of `%timeit`. Zero loops means that the
+// number of loops is picked automatically.
+func parseTimeitFlags(line string) (loops, runs int, rest string, err error) {
+	runs = timeitRuns
+	rest = strings.TrimSpace(line)
+	for strings.HasPrefix(rest, "-n") || strings.HasPrefix(rest, "-r") {
+		flag := rest[:2]
+		rest = strings.TrimSpace(rest[2:])
+
+		value := rest
+		if i := strings.IndexAny(rest, " \t"); i >= 0 {
+			value = rest[:i]
+		}
+		rest = strings.TrimSpace(rest[len(value):])
+
+		n, convErr := strconv.Atoi(value)
+		if convErr != nil || n <= 0 {
+			return 0, 0, "", fmt.Errorf("%%timeit: %s requires a positive number, got %q", flag, value)
+		}
+		if flag == "-n" {
+			loops = n
+		} else {
+			runs = n
+		}
+	}
+	return loops, runs, rest, nil
+}
+
+// timeit evaluates code `runs` times `loops` times and reports the mean and the standard deviation
+// of the time per loop, like IPython.
+func timeit(mc *MagicContext, code string, loops, runs int) error {
+	run := func(loops int) (time.Duration, error) {
+		start := time.Now()
+		for i := 0; i < loops; i++ {
+			if err := mc.Context.Err(); err != nil {
+				return 0, err
+			}
+			if _, err := mc.Kernel.eval(mc.ExecutionContext, code); err != nil {
+				return 0, err
+			}
+		}
+		return time.Since(start), nil
+	}
+
+	if loops == 0 {
+		// Pick the number of loops from the series 1, 2, 5, 10, 20, 50, ... so that a run takes
+		// at least timeitMinDuration.
+		for base := 1; loops == 0; base *= 10 {
+			for _, factor := range []int{1, 2, 5} {
+				d, err := run(base * factor)
+				if err != nil {
+					return err
+				}
+				if d >= timeitMinDuration {
+					loops = base * factor
+					break
+				}
+			}
+		}
+	}
+
+	perLoop := make([]float64, runs)
+	for i := range perLoop {
+		d, err := run(loops)
+		if err != nil {
+			return err
+		}
+		perLoop[i] = d.Seconds() / float64(loops)
+	}
+
+	mean, stddev := meanStddev(perLoop)
+	_, err := fmt.Fprintf(mc.Stdout, "%s ± %s per loop (mean ± std. dev. of %d %s, %d %s each)\n",
+		formatSeconds(mean), formatSeconds(stddev), runs, plural(runs, "run", "runs"), loops, plural(loops, "loop", "loops"))
+	return err
+}
+
+// meanStddev returns the mean and the standard deviation of `values`.
+func meanStddev(values []float64) (mean, stddev float64) {
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+	for _, v := range values {
+		stddev += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(stddev / float64(len(values)))
+}
+
+// formatSeconds formats a duration in seconds with three significant digits.
+func formatSeconds(s float64) string {
+	units := []struct {
+		name  string
+		scale float64
+	}{{"s", 1}, {"ms", 1e-3}, {"µs", 1e-6}, {"ns", 1e-9}}
+
+	if s >= 1000 {
+		return fmt.Sprintf("%.0f s", s)
+	}
+	for _, unit := range units {
+		if s >= unit.scale {
+			return fmt.Sprintf("%.3g %s", s/unit.scale, unit.name)
+		}
+	}
+	return fmt.Sprintf("%.3g ns", s/1e-9)
+}
+
+// formatBytes formats a number of bytes with a binary unit.
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// plural returns `one` if n is 1 and `many` otherwise.
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
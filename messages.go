@@ -1,12 +1,15 @@
 package jupyter
 
 import (
+	"bytes"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"io"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/go-zeromq/zmq4"
 	"github.com/gofrs/uuid"
@@ -199,6 +202,11 @@ func (receipt *msgReceipt) Publish(msgType string, content interface{}) error {
 // Reply creates a new ComposedMsg and sends it back to the return identities over the
 // Shell channel.
 func (receipt *msgReceipt) Reply(msgType string, content interface{}) error {
+	return receipt.ReplyWithMetadata(msgType, content, nil)
+}
+
+// ReplyWithMetadata is like Reply, but also sets the metadata of the reply.
+func (receipt *msgReceipt) ReplyWithMetadata(msgType string, content interface{}, metadata map[string]interface{}) error {
 	msg, err := NewMsg(msgType, receipt.Msg)
 
 	if err != nil {
@@ -206,6 +214,7 @@ func (receipt *msgReceipt) Reply(msgType string, content interface{}) error {
 	}
 
 	msg.Content = content
+	msg.Metadata = metadata
 	return receipt.Sockets.ShellSocket.RunWithSocket(func(shell zmq4.Socket) error {
 		return receipt.SendResponse(shell, msg)
 	})
@@ -323,23 +332,121 @@ func (receipt *msgReceipt) PublishWriteStream(stream string, data string) error
 	)
 }
 
+const (
+	// streamFlushInterval is how long a JupyterStreamWriter holds on to buffered output
+	// before publishing it.
+	streamFlushInterval = 50 * time.Millisecond
+
+	// streamFlushSize is the number of buffered bytes that causes a JupyterStreamWriter
+	// to publish immediately instead of waiting for the flush interval.
+	streamFlushSize = 64 * 1024
+
+	// streamFlushLines is the number of buffered lines that causes a JupyterStreamWriter
+	// to publish immediately, so that long bursts of short lines show up progressively.
+	streamFlushLines = 1000
+)
+
 // JupyterStreamWriter is an `io.Writer` implementation that writes the data to the notebook
-// front-end.
+// front-end. Writes are buffered and coalesced into a single "stream" message per flush
+// interval, size threshold or line threshold. Multi-byte UTF-8 sequences are never split
+// across messages. Call `Flush` once the writer is no longer used to publish the remainder.
 type JupyterStreamWriter struct {
 	stream  string
 	receipt *msgReceipt
+	limiter *outputLimiter
+
+	mu    sync.Mutex
+	buf   []byte
+	lines int
+	timer *time.Timer
+	err   error
 }
 
-// Write implements `io.Writer.Write` by publishing the data via `PublishWriteStream`
+// newJupyterStreamWriter creates a JupyterStreamWriter publishing to `stream` in reply to `receipt`.
+// The published volume is bounded by `limiter`, which may be nil.
+func newJupyterStreamWriter(stream string, receipt *msgReceipt, limiter *outputLimiter) *JupyterStreamWriter {
+	return &JupyterStreamWriter{stream: stream, receipt: receipt, limiter: limiter}
+}
+
+// Write implements `io.Writer.Write` by buffering the data until it is published via
+// `PublishWriteStream`. An error from a previous asynchronous publish is returned.
 func (writer *JupyterStreamWriter) Write(p []byte) (int, error) {
-	data := string(p)
-	n := len(p)
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+
+	if writer.err != nil {
+		return 0, writer.err
+	}
+
+	writer.buf = append(writer.buf, p...)
+	writer.lines += bytes.Count(p, []byte{'\n'})
+
+	if len(writer.buf) >= streamFlushSize || writer.lines >= streamFlushLines {
+		if err := writer.flushLocked(false); err != nil {
+			return 0, err
+		}
+	} else if writer.timer == nil {
+		writer.timer = time.AfterFunc(streamFlushInterval, writer.timedFlush)
+	}
 
-	if err := writer.receipt.PublishWriteStream(writer.stream, data); err != nil {
-		return 0, err
+	return len(p), nil
+}
+
+// Flush publishes all buffered data, including an incomplete trailing UTF-8 sequence.
+func (writer *JupyterStreamWriter) Flush() error {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+	return writer.flushLocked(true)
+}
+
+// timedFlush is invoked by the flush timer and publishes all complete runes.
+func (writer *JupyterStreamWriter) timedFlush() {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+	writer.flushLocked(false)
+}
+
+// flushLocked publishes the buffered data. Unless `final` is set, an incomplete UTF-8 sequence at
+// the end of the buffer is held back until the rest of it is written. The caller must hold `mu`.
+func (writer *JupyterStreamWriter) flushLocked(final bool) error {
+	if writer.timer != nil {
+		writer.timer.Stop()
+		writer.timer = nil
+	}
+
+	n := len(writer.buf)
+	if !final {
+		n = runeBoundary(writer.buf)
 	}
+	if n == 0 {
+		return writer.err
+	}
+
+	data := writer.limiter.reserveString(string(writer.buf[:n]))
+	writer.buf = append(writer.buf[:0], writer.buf[n:]...)
+	writer.lines = 0
+
+	if data == "" {
+		return writer.err
+	}
+	if err := writer.receipt.PublishWriteStream(writer.stream, data); err != nil && writer.err == nil {
+		writer.err = err
+	}
+	return writer.err
+}
 
-	return n, nil
+// runeBoundary returns the length of the longest prefix of p that does not end in the middle
+// of a UTF-8 sequence.
+func runeBoundary(p []byte) int {
+	for i := len(p) - 1; i >= 0 && i >= len(p)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(p[i]) {
+			if utf8.FullRune(p[i:]) {
+				return len(p)
+			}
+			return i
+		}
+	}
+	return len(p)
 }
 
 type OutErr struct {
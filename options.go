@@ -0,0 +1,236 @@
+package jupyter
+
+import (
+	"log/slog"
+	"time"
+)
+
+// KernelOptions holds the policies of a Kernel. They are set with Option values passed to
+// NewKernel or RunKernel; fields that are not set keep the defaults listed below.
+type KernelOptions struct {
+	// Logger receives the log output of the kernel. Defaults to slog.Default(). The capture of the
+	// standard output and error, which is shared by all kernels of the process, logs to the logger
+	// of the kernel that started it.
+	Logger *slog.Logger
+
+	// Hooks are called on lifecycle events of the kernel.
+	Hooks LifecycleHooks
+
+	// Magics enables `%` special commands. Defaults to true. When disabled, such lines are passed
+	// to the interpreter unchanged.
+	Magics bool
+
+	// ShellEscapes enables `$` and `!` shell commands. Defaults to true. When disabled, such lines
+	// are passed to the interpreter unchanged.
+	ShellEscapes bool
+
+	// Syntax is the syntax of the language of the interpreter, used to find special commands in
+	// cells. Defaults to the syntax of an Interpreter implementing LanguageSyntax, else GoSyntax.
+	Syntax *Syntax
+
+	// Shell runs the `$` and `!` shell commands and `%%sh` cells as `Shell -c command`. Defaults
+	// to /bin/sh.
+	Shell string
+
+	// Pty runs shell commands in a pseudo-terminal, so that they keep their colors, progress
+	// output and line buffering. Like in a terminal, their standard error then goes to the stdout
+	// stream of the notebook; disable Pty to keep it in the stderr stream. Defaults to true; only
+	// supported on Linux.
+	Pty bool
+
+	// TerminalWidth is the width of the pseudo-terminal of shell commands. Defaults to 80.
+	TerminalWidth int
+
+	// ShellStdin lets shell commands in a pseudo-terminal read from the stdin channel of the
+	// front-end: when a command waits at a prompt, the front-end asks the user for input.
+	// Defaults to false.
+	ShellStdin bool
+
+	// Policy restricts shell commands and file access of cells. Defaults to the zero Policy,
+	// which allows everything.
+	Policy Policy
+
+	// CellTimeout, if not zero, is the default limit of the run time of a cell, which `%timeout`
+	// changes for the rest of a cell. When it expires, the context of the cell is cancelled, which
+	// stops shell commands and interpreters implementing Evaluator that honor it.
+	CellTimeout time.Duration
+
+	// MemoryLimit, if not zero, is set as the soft memory limit of the Go runtime with
+	// debug.SetMemoryLimit, and cells write a warning when the memory of the process gets close
+	// to it. The limit applies to the whole process: with several kernels, the one created last
+	// sets it for all of them.
+	MemoryLimit int64
+
+	// HelpText replaces the output of `%help`, which is otherwise generated from the magics of
+	// the kernel.
+	HelpText string
+
+	// HeartbeatTimeout is how long the kernel waits for a heartbeat ping from the front-end before
+	// calling LifecycleHooks.OnHeartbeatTimeout. Defaults to 500 seconds; values that are not
+	// positive keep the default.
+	HeartbeatTimeout time.Duration
+
+	// OutputLimits bounds the output of every cell. Defaults to DefaultOutputLimits.
+	OutputLimits OutputLimits
+
+	// Pretty formats the text/plain representation of the results of cells. Defaults to
+	// DefaultPrettyOptions.
+	Pretty PrettyOptions
+
+	// Tables bounds the tables displayed for slices of structs, slices of slices and maps
+	// returned by cells. Defaults to DefaultTableOptions.
+	Tables TableOptions
+}
+
+// LifecycleHooks are functions called on lifecycle events of a Kernel. Nil hooks are skipped.
+type LifecycleHooks struct {
+	// OnStart is called when the kernel starts serving requests.
+	OnStart func(kernel *Kernel)
+
+	// OnShutdown is called when the kernel received a shutdown_request, before it stops.
+	OnShutdown func(kernel *Kernel, restart bool)
+
+	// OnHeartbeatTimeout is called each time no heartbeat ping was received for
+	// KernelOptions.HeartbeatTimeout, which usually means the front-end went away.
+	OnHeartbeatTimeout func(kernel *Kernel)
+}
+
+// Option configures a Kernel.
+type Option func(opts *KernelOptions)
+
+// defaultKernelOptions returns the options of a Kernel before any Option is applied.
+func defaultKernelOptions() KernelOptions {
+	return KernelOptions{
+		Logger:           slog.Default(),
+		Magics:           true,
+		ShellEscapes:     true,
+		Shell:            "/bin/sh",
+		Pty:              true,
+		TerminalWidth:    80,
+		HeartbeatTimeout: 500 * time.Second,
+		OutputLimits:     DefaultOutputLimits,
+		Pretty:           DefaultPrettyOptions,
+		Tables:           DefaultTableOptions,
+	}
+}
+
+// WithLogger sends the log output of the kernel to `logger`.
+func WithLogger(logger *slog.Logger) Option {
+	return func(opts *KernelOptions) {
+		opts.Logger = logger
+	}
+}
+
+// WithLifecycleHooks sets the functions called on lifecycle events of the kernel.
+func WithLifecycleHooks(hooks LifecycleHooks) Option {
+	return func(opts *KernelOptions) {
+		opts.Hooks = hooks
+	}
+}
+
+// WithMagics enables or disables `%` special commands.
+func WithMagics(enabled bool) Option {
+	return func(opts *KernelOptions) {
+		opts.Magics = enabled
+	}
+}
+
+// WithShellEscapes enables or disables `$` and `!` shell commands.
+func WithShellEscapes(enabled bool) Option {
+	return func(opts *KernelOptions) {
+		opts.ShellEscapes = enabled
+	}
+}
+
+// WithSyntax sets the syntax of the language of the interpreter.
+func WithSyntax(syntax Syntax) Option {
+	return func(opts *KernelOptions) {
+		opts.Syntax = &syntax
+	}
+}
+
+// WithShell sets the shell running shell commands.
+func WithShell(shell string) Option {
+	return func(opts *KernelOptions) {
+		opts.Shell = shell
+	}
+}
+
+// WithPty enables or disables running shell commands in a pseudo-terminal.
+func WithPty(enabled bool) Option {
+	return func(opts *KernelOptions) {
+		opts.Pty = enabled
+	}
+}
+
+// WithTerminalWidth sets the width of the pseudo-terminal of shell commands.
+func WithTerminalWidth(cols int) Option {
+	return func(opts *KernelOptions) {
+		opts.TerminalWidth = cols
+	}
+}
+
+// WithShellStdin enables or disables answering prompts of shell commands from the front-end.
+func WithShellStdin(enabled bool) Option {
+	return func(opts *KernelOptions) {
+		opts.ShellStdin = enabled
+	}
+}
+
+// WithPolicy restricts shell commands and file access of cells.
+func WithPolicy(policy Policy) Option {
+	return func(opts *KernelOptions) {
+		opts.Policy = policy
+	}
+}
+
+// WithCellTimeout sets the default limit of the run time of a cell.
+func WithCellTimeout(timeout time.Duration) Option {
+	return func(opts *KernelOptions) {
+		opts.CellTimeout = timeout
+	}
+}
+
+// WithMemoryLimit sets the soft memory limit of the process, in bytes. It replaces the limit set
+// by other kernels of the process.
+func WithMemoryLimit(limit int64) Option {
+	return func(opts *KernelOptions) {
+		opts.MemoryLimit = limit
+	}
+}
+
+// WithHelpText replaces the output of `%help`.
+func WithHelpText(text string) Option {
+	return func(opts *KernelOptions) {
+		opts.HelpText = text
+	}
+}
+
+// WithHeartbeatTimeout sets how long the kernel waits for a heartbeat ping before calling
+// LifecycleHooks.OnHeartbeatTimeout. A timeout that is not positive is ignored.
+func WithHeartbeatTimeout(timeout time.Duration) Option {
+	return func(opts *KernelOptions) {
+		opts.HeartbeatTimeout = timeout
+	}
+}
+
+// WithOutputLimits bounds the output of every cell.
+func WithOutputLimits(limits OutputLimits) Option {
+	return func(opts *KernelOptions) {
+		opts.OutputLimits = limits
+	}
+}
+
+// WithPrettyOptions sets the formatting of the text/plain representation of the results of cells.
+func WithPrettyOptions(pretty PrettyOptions) Option {
+	return func(opts *KernelOptions) {
+		opts.Pretty = pretty
+	}
+}
+
+// WithTableOptions sets the limits of the tables displayed for the results of cells.
+func WithTableOptions(tables TableOptions) Option {
+	return func(opts *KernelOptions) {
+		opts.Tables = tables
+	}
+}
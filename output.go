@@ -0,0 +1,336 @@
+package jupyter
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// drainMarker starts the markers written into the captured streams to find out when all output
+// written before them has been forwarded. A marker is followed by an id and a NUL byte.
+const drainMarker = "\x00\x1bjupyter-drain:"
+
+// outputRouter forwards the captured standard output and error of the process to the notebook.
+// It stays installed for as long as a kernel exists, so output that goroutines write after their
+// cell finished is still published, under the cell that started last. A single router is shared
+// by all kernels of the process. Output cannot be attributed to one of several kernels, so while
+// more than one kernel exists it goes to the original standard output and error instead, and the
+// cell that started last is warned.
+type outputRouter struct {
+	capture *stdioCapture
+	logger  *slog.Logger
+
+	mu      sync.Mutex
+	stdout  *JupyterStreamWriter
+	stderr  *JupyterStreamWriter
+	shared  bool
+	warned  bool
+	drainID uint64
+	acks    map[string]chan struct{}
+
+	wg sync.WaitGroup
+}
+
+var (
+	sharedRouterMu   sync.Mutex
+	sharedRouter     *outputRouter
+	sharedRouterRefs int
+)
+
+// acquireOutputRouter returns the output router of the process, starting it if needed with `logger`
+// for its own errors. Every call must be paired with a call to releaseOutputRouter.
+func acquireOutputRouter(logger *slog.Logger) (*outputRouter, error) {
+	sharedRouterMu.Lock()
+	defer sharedRouterMu.Unlock()
+
+	if sharedRouter == nil {
+		r, err := startOutputRouter(logger)
+		if err != nil {
+			return nil, err
+		}
+		sharedRouter = r
+	}
+	sharedRouterRefs++
+	sharedRouter.setShared(sharedRouterRefs > 1)
+	return sharedRouter, nil
+}
+
+// releaseOutputRouter closes the output router of the process once it is no longer used.
+func releaseOutputRouter() error {
+	sharedRouterMu.Lock()
+	defer sharedRouterMu.Unlock()
+
+	sharedRouterRefs--
+	if sharedRouter == nil {
+		return nil
+	}
+	if sharedRouterRefs > 0 {
+		sharedRouter.setShared(sharedRouterRefs > 1)
+		return nil
+	}
+	r := sharedRouter
+	sharedRouter = nil
+	return r.Close()
+}
+
+// startOutputRouter captures the standard output and error of the process and starts forwarding them.
+func startOutputRouter(logger *slog.Logger) (*outputRouter, error) {
+	capture, err := captureStdio(logger)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &outputRouter{
+		capture: capture,
+		logger:  logger,
+		acks:    make(map[string]chan struct{}),
+	}
+
+	r.wg.Add(2)
+	go r.route(StreamStdout, capture.stdout)
+	go r.route(StreamStderr, capture.stderr)
+
+	return r, nil
+}
+
+// sharedOutputWarning is written to the stderr stream of the current cell when process output is
+// passed through because several kernels share the router.
+const sharedOutputWarning = "Output written to the standard output or error of the process is not shown: " +
+	"several kernels run in this process. Write to ExecutionContext.Stdout and ExecutionContext.Stderr instead.\n"
+
+// isShared reports whether several kernels use the router.
+func (r *outputRouter) isShared() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.shared
+}
+
+// setShared sets whether several kernels use the router. The current cell, which may belong to
+// any of them, stops receiving output: the next cell that begins receives it again.
+func (r *outputRouter) setShared(shared bool) {
+	r.drain()
+
+	r.mu.Lock()
+	prevOut, prevErr := r.stdout, r.stderr
+	r.stdout, r.stderr = nil, nil
+	r.shared = shared
+	r.mu.Unlock()
+
+	flushWriters(r.logger, prevOut, prevErr)
+}
+
+// begin attributes all output written from now on to the cell of `receipt` and returns the
+// writers of that cell. Output written before is still published under the previous cell.
+func (r *outputRouter) begin(receipt *msgReceipt, limiter *outputLimiter) (stdout, stderr *JupyterStreamWriter) {
+	r.drain()
+
+	stdout = newJupyterStreamWriter(StreamStdout, receipt, limiter)
+	stderr = newJupyterStreamWriter(StreamStderr, receipt, limiter)
+
+	r.mu.Lock()
+	prevOut, prevErr := r.stdout, r.stderr
+	r.stdout, r.stderr = stdout, stderr
+	r.warned = false
+	r.mu.Unlock()
+
+	flushWriters(r.logger, prevOut, prevErr)
+
+	return stdout, stderr
+}
+
+// end publishes all output written so far to the writers returned by begin. Later output keeps
+// going to the same cell until the next call to begin.
+func (r *outputRouter) end(stdout, stderr *JupyterStreamWriter) {
+	r.drain()
+	flushWriters(r.logger, stdout, stderr)
+}
+
+// Close publishes all pending output and restores the standard output and error of the process.
+func (r *outputRouter) Close() error {
+	r.drain()
+
+	r.mu.Lock()
+	stdout, stderr := r.stdout, r.stderr
+	r.mu.Unlock()
+
+	flushWriters(r.logger, stdout, stderr)
+
+	err := r.capture.Restore()
+	go func() {
+		r.wg.Wait()
+		r.capture.Close()
+	}()
+	return err
+}
+
+// drain waits until all output written to the captured streams so far has been handed to the
+// writers, or captureDrainTimeout expires.
+func (r *outputRouter) drain() {
+	r.mu.Lock()
+	r.drainID++
+	id := strconv.FormatUint(r.drainID, 10)
+	stdoutAck := make(chan struct{})
+	stderrAck := make(chan struct{})
+	r.acks[StreamStdout+id] = stdoutAck
+	r.acks[StreamStderr+id] = stderrAck
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		delete(r.acks, StreamStdout+id)
+		delete(r.acks, StreamStderr+id)
+		r.mu.Unlock()
+	}()
+
+	marker := drainMarker + id + "\x00"
+	if _, err := io.WriteString(r.capture.stdoutW, marker); err != nil {
+		r.logger.Error("draining captured stdout", "err", err)
+		return
+	}
+	if _, err := io.WriteString(r.capture.stderrW, marker); err != nil {
+		r.logger.Error("draining captured stderr", "err", err)
+		return
+	}
+
+	timeout := time.NewTimer(captureDrainTimeout)
+	defer timeout.Stop()
+
+	for _, ack := range []chan struct{}{stdoutAck, stderrAck} {
+		select {
+		case <-ack:
+		case <-timeout.C:
+			r.logger.Warn("timed out waiting for captured output to be forwarded")
+			return
+		}
+	}
+}
+
+// route forwards the data read from `src` to the current writer of `stream` until `src` is closed.
+func (r *outputRouter) route(stream string, src io.Reader) {
+	defer r.wg.Done()
+
+	buf := make([]byte, 32*1024)
+	var pending []byte
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			pending = r.forward(stream, append(pending, buf[:n]...))
+		}
+		if err != nil {
+			r.write(stream, pending)
+			return
+		}
+	}
+}
+
+// forward writes `p` to the current writer of `stream`, acknowledging the drain markers it
+// contains. It returns the trailing part of `p` that may be the start of a marker.
+func (r *outputRouter) forward(stream string, p []byte) []byte {
+	for {
+		i := bytes.Index(p, []byte(drainMarker))
+		if i < 0 {
+			keep := partialSuffix(p, drainMarker)
+			r.write(stream, p[:len(p)-keep])
+			return p[len(p)-keep:]
+		}
+
+		r.write(stream, p[:i])
+
+		rest := p[i+len(drainMarker):]
+		end := bytes.IndexByte(rest, 0)
+		if end < 0 {
+			return p[i:]
+		}
+		r.ack(stream + string(rest[:end]))
+		p = rest[end+1:]
+	}
+}
+
+// write hands `p` to the current writer of `stream`, or passes it through while the router is
+// shared, warning the current cell once. Output written before the first cell is dropped.
+func (r *outputRouter) write(stream string, p []byte) {
+	if len(p) == 0 {
+		return
+	}
+
+	r.mu.Lock()
+	w, shared, warnW := r.stdout, r.shared, r.stderr
+	if stream == StreamStderr {
+		w = r.stderr
+	}
+	if !shared || r.warned {
+		warnW = nil
+	}
+	if warnW != nil {
+		r.warned = true
+	}
+	r.mu.Unlock()
+
+	if shared {
+		r.passThrough(stream, p)
+		if warnW != nil {
+			if _, err := io.WriteString(warnW, sharedOutputWarning); err != nil {
+				r.logger.Error("publishing shared output warning", "err", err)
+			}
+		}
+		return
+	}
+	if w == nil {
+		return
+	}
+	if _, err := w.Write(p); err != nil {
+		r.logger.Error("forwarding captured output", "stream", stream, "err", err)
+	}
+}
+
+// passThrough writes `p` to the original standard output or error of the process.
+func (r *outputRouter) passThrough(stream string, p []byte) {
+	orig := r.capture.origStdout
+	if stream == StreamStderr {
+		orig = r.capture.origStderr
+	}
+	if _, err := orig.Write(p); err != nil {
+		r.logger.Error("passing through captured output", "stream", stream, "err", err)
+	}
+}
+
+// ack signals the drain waiting for the marker `key`.
+func (r *outputRouter) ack(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if ack, ok := r.acks[key]; ok {
+		close(ack)
+		delete(r.acks, key)
+	}
+}
+
+// partialSuffix returns the length of the longest suffix of `p` that is a proper prefix of `marker`.
+func partialSuffix(p []byte, marker string) int {
+	n := len(marker) - 1
+	if n > len(p) {
+		n = len(p)
+	}
+	for ; n > 0; n-- {
+		if bytes.HasSuffix(p, []byte(marker[:n])) {
+			return n
+		}
+	}
+	return 0
+}
+
+// flushWriters publishes the output buffered in the given writers, skipping nil ones. Errors are
+// logged to `logger`.
+func flushWriters(logger *slog.Logger, writers ...*JupyterStreamWriter) {
+	for _, w := range writers {
+		if w == nil {
+			continue
+		}
+		if err := w.Flush(); err != nil {
+			logger.Error("publishing stream", "stream", w.stream, "err", err)
+		}
+	}
+}
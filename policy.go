@@ -0,0 +1,187 @@
+package jupyter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrPolicyViolation is wrapped by the errors of cells that did something the Policy of the kernel
+// forbids.
+var ErrPolicyViolation = errors.New("policy violation")
+
+// Policy restricts what cells may do besides running code in the interpreter, for kernels used by
+// less-trusted users. The zero Policy allows everything. Any other Policy also keeps `%env` from
+// setting the variables that make programs load or run other code, like LD_PRELOAD, BASH_ENV or
+// GIT_SSH_COMMAND.
+type Policy struct {
+	// NoShell forbids shell commands: `$` and `!` escapes, `name = !command`, `%%sh` and `%%bash`.
+	// Unlike disabling KernelOptions.ShellEscapes, which passes such lines to the interpreter,
+	// using them is an error.
+	NoShell bool
+
+	// AllowedExecutables, if not nil, lists the executables shell commands may run, by name as
+	// looked up in the $PATH of the process, which `%env` does not change, or by absolute path.
+	// `$` and `!` commands then run without a shell, so pipes, redirections and expansions are
+	// not available, and the `%%sh` and `%%bash` cells are only allowed if their shell is listed.
+	AllowedExecutables []string
+
+	// RootDir, if set, confines the working directory of `%cd`, the files written by
+	// `%%writefile` and the files read by `%load` and `%run` to this directory and its
+	// subdirectories.
+	RootDir string
+
+	// CommandTimeout, if not zero, bounds the run time of each shell command.
+	CommandTimeout time.Duration
+
+	// MaxCommandOutput, if not zero, bounds the number of bytes of output of each shell command.
+	// The command is stopped when it writes more.
+	MaxCommandOutput int64
+}
+
+// policyError returns an error wrapping ErrPolicyViolation.
+func policyError(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrPolicyViolation, fmt.Sprintf(format, args...))
+}
+
+// checkShell returns an error if shell commands are forbidden.
+func (p *Policy) checkShell() error {
+	if p.NoShell {
+		return policyError("shell commands are disabled")
+	}
+	return nil
+}
+
+// checkExecutable returns an error if the executable `name`, run in `dir`, is not allowed.
+func (p *Policy) checkExecutable(dir, name string) error {
+	if p.AllowedExecutables == nil {
+		return nil
+	}
+
+	path := resolveExecutable(dir, name)
+	for _, allowed := range p.AllowedExecutables {
+		if path != "" && path == resolveExecutable(dir, allowed) {
+			return nil
+		}
+	}
+	return policyError("executable %q is not allowed", name)
+}
+
+// resolveExecutable returns the path of the executable `name` run in `dir`, or "" if there is none.
+func resolveExecutable(dir, name string) string {
+	if strings.ContainsRune(name, filepath.Separator) {
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(dir, name)
+		}
+		return filepath.Clean(name)
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// restrictive reports whether the policy restricts anything.
+func (p *Policy) restrictive() bool {
+	return p.NoShell || p.AllowedExecutables != nil || p.RootDir != "" ||
+		p.CommandTimeout != 0 || p.MaxCommandOutput != 0
+}
+
+// hookEnvNames are environment variables that make the dynamic loader, shells or common tools
+// load or run code of their choosing.
+var hookEnvNames = []string{
+	"BASH_ENV", "ENV", "SHELLOPTS", "BASHOPTS", "PROMPT_COMMAND", "PS4", "IFS",
+	"GIT_SSH", "GIT_SSH_COMMAND", "GIT_EXEC_PATH", "GIT_ASKPASS", "SSH_ASKPASS", "PAGER", "EDITOR",
+	"PERL5OPT", "PERL5LIB", "PYTHONSTARTUP", "PYTHONPATH", "NODE_OPTIONS", "RUBYOPT",
+}
+
+// hookEnvPrefixes are prefixes of the names of such variables.
+var hookEnvPrefixes = []string{"LD_", "DYLD_", "BASH_FUNC_", "GIT_CONFIG"}
+
+// checkEnv returns an error if a restrictive policy forbids setting the environment variable
+// `name`.
+func (p *Policy) checkEnv(name string) error {
+	if !p.restrictive() {
+		return nil
+	}
+	forbidden := slices.Contains(hookEnvNames, name)
+	for _, prefix := range hookEnvPrefixes {
+		forbidden = forbidden || strings.HasPrefix(name, prefix)
+	}
+	if forbidden {
+		return policyError("environment variable %s may not be set", name)
+	}
+	return nil
+}
+
+// checkPath returns an error if `path` is outside of the root directory.
+func (p *Policy) checkPath(path string) error {
+	if p.RootDir == "" || isWithin(p.RootDir, path) {
+		return nil
+	}
+	return policyError("%s is outside of %s", path, p.RootDir)
+}
+
+// isWithin reports whether `path` is `root` or below it, following symbolic links of the parts
+// of the paths that exist.
+func isWithin(root, path string) bool {
+	rel, err := filepath.Rel(evalExistingSymlinks(root), evalExistingSymlinks(path))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// evalExistingSymlinks resolves the symbolic links of the longest existing prefix of path.
+func evalExistingSymlinks(path string) string {
+	path = filepath.Clean(path)
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	parent := filepath.Dir(path)
+	if parent == path {
+		return path
+	}
+	return filepath.Join(evalExistingSymlinks(parent), filepath.Base(path))
+}
+
+// limitedWriter passes the output of a command to w until `limit` bytes were written in total
+// through all limitedWriters sharing the budget, then calls stop.
+type limitedWriter struct {
+	w      io.Writer
+	budget *outputBudget
+}
+
+// outputBudget is the number of bytes of output a command may still write.
+type outputBudget struct {
+	mu       sync.Mutex
+	left     int64
+	exceeded bool
+	stop     context.CancelFunc
+}
+
+func (lw *limitedWriter) Write(p []byte) (int, error) {
+	b := lw.budget
+	b.mu.Lock()
+	n := int64(len(p))
+	if n > b.left {
+		n = b.left
+		if !b.exceeded {
+			b.exceeded = true
+			b.stop()
+		}
+	}
+	b.left -= n
+	b.mu.Unlock()
+
+	if _, err := lw.w.Write(p[:n]); err != nil {
+		return 0, err
+	}
+	// Report the whole write as done, so that the command is stopped rather than the copy.
+	return len(p), nil
+}
@@ -0,0 +1,146 @@
+package jupyter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestIsWithin tests that paths are within a root directory only if they are below it once symbolic links
+// are resolved.
+func TestIsWithin(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Symlink(os.TempDir(), filepath.Join(root, "out")); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		path   string
+		within bool
+	}{
+		{root, true},
+		{filepath.Join(root, "a", "b"), true},
+		{filepath.Join(root, "a", "..", ".."), false},
+		{filepath.Join(root, "..foo"), true},
+		{filepath.Dir(root), false},
+		{filepath.Join(root, "out", "x"), false},
+	}
+	for _, c := range cases {
+		if within := isWithin(root, c.path); within != c.within {
+			t.Fatalf("\t%s isWithin(%q, %q) = %v, expected %v", failure, root, c.path, within, c.within)
+		}
+	}
+	t.Logf("\t%s Paths were checked.", success)
+}
+
+// testPolicyError executes code and checks that it fails with a policy violation mentioning want.
+func testPolicyError(t *testing.T, client testJupyterClient, code, want string) {
+	t.Helper()
+	content, _ := client.executeCode(t, code)
+	if status := getString(t, "content", content, "status"); status != "error" {
+		t.Fatalf("\t%s Expected %q to fail", failure, code)
+	}
+	evalue := getString(t, "content", content, "evalue")
+	if !strings.Contains(evalue, ErrPolicyViolation.Error()) || !strings.Contains(evalue, want) {
+		t.Fatalf("\t%s Unexpected error of %q: %q", failure, code, evalue)
+	}
+}
+
+// TestPolicy tests that the restrictions of a Policy are enforced on shell commands and magics.
+func TestPolicy(t *testing.T) {
+	t.Run("NoShell", func(t *testing.T) {
+		_, client := startTestKernel(t, WithPolicy(Policy{NoShell: true}))
+		for _, code := range []string{"$echo hi", "!echo hi", "x = !echo hi", "%%sh\necho hi", "%%bash\necho hi"} {
+			testPolicyError(t, client, code, "shell commands are disabled")
+		}
+		t.Logf("\t%s Shell commands were refused.", success)
+	})
+
+	t.Run("AllowedExecutables", func(t *testing.T) {
+		_, client := startTestKernel(t, WithPty(false), WithPolicy(Policy{AllowedExecutables: []string{"echo"}}))
+
+		// No shell runs the command: `;` is an argument of echo.
+		stdout, _ := testOutputStreamFor(t, client, "$echo 'a  b'; ls")
+		if out := strings.Join(stdout, ""); out != "a  b; ls\n" {
+			t.Fatalf("\t%s Unexpected output %q", failure, out)
+		}
+		testPolicyError(t, client, "$ls", `executable "ls" is not allowed`)
+		testPolicyError(t, client, "%%sh\necho hi", `executable "/bin/sh" is not allowed`)
+
+		// Changing $PATH with %env does not change the executables the names resolve to.
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "echo"), []byte("#!/bin/sh\necho fake\n"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		stdout, _ = testOutputStreamFor(t, client, "%env PATH="+dir+"\n$echo real")
+		if out := strings.Join(stdout, ""); !strings.HasSuffix(out, "\nreal\n") {
+			t.Fatalf("\t%s Unexpected output %q", failure, out)
+		}
+		t.Logf("\t%s Only allowed executables were run.", success)
+	})
+
+	t.Run("Env", func(t *testing.T) {
+		_, client := startTestKernel(t, WithPolicy(Policy{AllowedExecutables: []string{"echo"}}))
+		for _, code := range []string{"%env LD_PRELOAD=/tmp/x.so", "%env BASH_ENV /tmp/x.sh", "%%env\nGIT_SSH_COMMAND=sh"} {
+			testPolicyError(t, client, code, "may not be set")
+		}
+
+		content, _ := client.executeCode(t, "%env GREETING=hello")
+		if status := getString(t, "content", content, "status"); status != "ok" {
+			t.Fatalf("\t%s Expected other variables to be set", failure)
+		}
+		t.Logf("\t%s Loader and shell hook variables were refused.", success)
+	})
+
+	t.Run("CommandTimeout", func(t *testing.T) {
+		_, client := startTestKernel(t, WithPty(false), WithPolicy(Policy{CommandTimeout: 100 * time.Millisecond}))
+		start := time.Now()
+		testPolicyError(t, client, "$sleep 10", "timed out after 100ms")
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Fatalf("\t%s The command was not stopped, it took %v", failure, elapsed)
+		}
+		t.Logf("\t%s The command timed out.", success)
+	})
+
+	t.Run("MaxCommandOutput", func(t *testing.T) {
+		_, client := startTestKernel(t, WithPty(false), WithPolicy(Policy{MaxCommandOutput: 10}))
+		testPolicyError(t, client, "$yes", "exceeded 10 bytes")
+		testPolicyError(t, client, "lines = !yes", "exceeded 10 bytes")
+
+		stdout, _ := testOutputStreamFor(t, client, "$echo short")
+		if out := strings.Join(stdout, ""); out != "short\n" {
+			t.Fatalf("\t%s Unexpected output %q", failure, out)
+		}
+		t.Logf("\t%s The output of commands was limited.", success)
+	})
+
+	t.Run("RootDir", func(t *testing.T) {
+		root := t.TempDir()
+		if err := os.Mkdir(filepath.Join(root, "sub"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		_, client := startTestKernel(t, WithPolicy(Policy{RootDir: root}))
+
+		testPolicyError(t, client, "%cd ..", "outside of "+root)
+		testPolicyError(t, client, "%%writefile ../escaped.txt\nx", "outside of "+root)
+		testPolicyError(t, client, fmt.Sprintf("%%%%writefile %q\nx", filepath.Join(os.TempDir(), "escaped.txt")), "outside of")
+		testPolicyError(t, client, "%load /etc/passwd", "outside of "+root)
+		testPolicyError(t, client, "%run ../outside.go", "outside of "+root)
+
+		content, _ := client.executeCode(t, "%cd sub\n%cd ..\n%cd sub")
+		if status := getString(t, "content", content, "status"); status != "ok" {
+			t.Fatalf("\t%s Expected %%cd within the root directory to succeed", failure)
+		}
+		content, _ = client.executeCode(t, "%%writefile a.txt\nhello")
+		if status := getString(t, "content", content, "status"); status != "ok" {
+			t.Fatalf("\t%s Expected %%%%writefile within the root directory to succeed", failure)
+		}
+		if data, err := os.ReadFile(filepath.Join(root, "sub", "a.txt")); err != nil || string(data) != "hello" {
+			t.Fatalf("\t%s Unexpected file %q %v", failure, data, err)
+		}
+		t.Logf("\t%s Paths were confined to the root directory.", success)
+	})
+}
@@ -0,0 +1,350 @@
+package jupyter
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/types"
+	"strings"
+)
+
+// Syntax describes the lexical syntax of the language of an Interpreter. The kernel uses it to
+// find special commands in cells: lines starting with `%`, `$`, `!` or `name = !` are special
+// commands only when they don't start inside a string literal, a comment or brackets.
+//
+// The syntax is set with WithSyntax, or by an Interpreter implementing LanguageSyntax. It defaults
+// to GoSyntax.
+type Syntax struct {
+	// LineComments start comments running to the end of the line, like "//".
+	LineComments []string
+
+	// BlockComments are the delimiters of comments that may span lines, like {"/*", "*/"}.
+	BlockComments [][2]string
+
+	// Strings are the string and character literals of the language. When several delimiters
+	// share a prefix, the longer ones must come first.
+	Strings []Quote
+
+	// Brackets are the pairs of brackets whose contents may continue on the next lines.
+	Brackets [][2]byte
+
+	// LiteralEscape at the start of a line passes the rest of the line to the interpreter
+	// unchanged, even if it looks like a special command.
+	LiteralEscape string
+
+	// IsCode, if not nil, is called with lines that look like special commands and reports
+	// whether they are code of the language instead. defined reports whether a name is a
+	// variable of the interpreter; it always reports false if the interpreter does not implement
+	// VariableLookup.
+	IsCode func(line string, defined func(name string) bool) bool
+}
+
+// Quote describes a kind of string literal.
+type Quote struct {
+	// Delim opens and closes the literal.
+	Delim string
+
+	// Raw literals have no backslash escapes.
+	Raw bool
+
+	// Multiline literals may span lines.
+	Multiline bool
+}
+
+// LanguageSyntax may be implemented by an Interpreter to describe the syntax of its language.
+type LanguageSyntax interface {
+	Syntax() Syntax
+}
+
+// GoSyntax is the syntax of Go.
+var GoSyntax = Syntax{
+	LineComments:  []string{"//"},
+	BlockComments: [][2]string{{"/*", "*/"}},
+	Strings: []Quote{
+		{Delim: "`", Raw: true, Multiline: true},
+		{Delim: `"`},
+		{Delim: "'"},
+	},
+	Brackets:      [][2]byte{{'(', ')'}, {'[', ']'}, {'{', '}'}},
+	LiteralEscape: `\`,
+	IsCode:        isGoCode,
+}
+
+// isGoCode reports whether a `!` line, or a `name = !` assignment, is Go code rather than a shell
+// command: it is Go when the `!` expression parses as Go and all its identifiers are predeclared
+// or variables of the interpreter, like `!ok` when ok is a variable. So `!ls -l`, which parses as
+// `!ls - l`, stays a shell command unless ls and l are variables. `!!` always starts a shell
+// command.
+func isGoCode(line string, defined func(name string) bool) bool {
+	var expr string
+	switch {
+	case strings.HasPrefix(line, "!"):
+		expr = line
+	case shellAssignment.MatchString(line):
+		_, expr, _ = strings.Cut(line, "=")
+		expr = strings.TrimSpace(expr)
+	default:
+		return false
+	}
+	if strings.HasPrefix(expr, "!!") {
+		return false
+	}
+	x, err := parser.ParseExpr(expr)
+	if err != nil {
+		return false
+	}
+
+	resolved := true
+	var resolve func(n ast.Node) bool
+	resolve = func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			// only the operand names something in scope
+			ast.Inspect(n.X, resolve)
+			return false
+		case *ast.Ident:
+			if types.Universe.Lookup(n.Name) == nil && !defined(n.Name) {
+				resolved = false
+			}
+		}
+		return resolved
+	}
+	ast.Inspect(x, resolve)
+	return resolved
+}
+
+// isDefined reports whether name is a variable of the interpreter.
+func (kernel *Kernel) isDefined(name string) bool {
+	lookup, ok := kernel.ir.(VariableLookup)
+	if !ok {
+		return false
+	}
+	_, ok = lookup.Lookup(name)
+	return ok
+}
+
+// syntax returns the syntax of the language of the interpreter.
+func (kernel *Kernel) syntax() Syntax {
+	if kernel.opts.Syntax != nil {
+		return *kernel.opts.Syntax
+	}
+	if ls, ok := kernel.ir.(LanguageSyntax); ok {
+		return ls.Syntax()
+	}
+	return GoSyntax
+}
+
+// segmentKind is the kind of a part of a cell.
+type segmentKind int
+
+const (
+	segmentCode segmentKind = iota
+	segmentMagic
+	segmentShell
+	segmentShellAssignment
+)
+
+// segment is a part of a cell: either consecutive lines of code, or a special command.
+type segment struct {
+	kind segmentKind
+
+	// text is the code, or the trimmed line of the special command.
+	text string
+
+	// line is the index of the first line of the segment in the cell.
+	line int
+}
+
+// splitSpecialCommands splits a cell into code and special commands, in the order they appear.
+func (kernel *Kernel) splitSpecialCommands(code string) []segment {
+	syntax := kernel.syntax()
+	lexer := lexer{syntax: &syntax}
+
+	var (
+		segments []segment
+		lines    = strings.Split(code, "\n")
+		pending  []string
+		first    int
+	)
+	flush := func() {
+		if len(pending) != 0 {
+			segments = append(segments, segment{segmentCode, strings.Join(pending, "\n"), first})
+			pending = nil
+		}
+	}
+
+	for i, line := range lines {
+		kind, text := kernel.classifyLine(&lexer, line)
+		if kind != segmentCode {
+			flush()
+			segments = append(segments, segment{kind, text, i})
+			continue
+		}
+
+		if len(pending) == 0 {
+			first = i
+		}
+		pending = append(pending, text)
+	}
+	flush()
+	return segments
+}
+
+// classifyLine returns the kind of a line of a cell. A special command is returned trimmed. Code
+// is returned as it is passed to the interpreter, and the lexer advances over it.
+func (kernel *Kernel) classifyLine(lexer *lexer, line string) (segmentKind, string) {
+	if lexer.atTopLevel() {
+		trimmed := strings.TrimSpace(line)
+		if kind, ok := kernel.specialCommandKind(lexer.syntax, trimmed); ok {
+			return kind, trimmed
+		}
+		if rest, ok := cutLiteralEscape(lexer.syntax, trimmed); ok {
+			line = rest
+		}
+	}
+	lexer.scanLine(line)
+	return segmentCode, line
+}
+
+// specialCommandKind returns the kind of special command of a trimmed line at the top level.
+func (kernel *Kernel) specialCommandKind(syntax *Syntax, line string) (segmentKind, bool) {
+	var kind segmentKind
+	switch {
+	case line == "":
+		return 0, false
+	case line[0] == '%' && kernel.opts.Magics:
+		kind = segmentMagic
+	case (line[0] == '$' || line[0] == '!') && kernel.opts.ShellEscapes:
+		kind = segmentShell
+	case kernel.opts.ShellEscapes && shellAssignment.MatchString(line):
+		kind = segmentShellAssignment
+	default:
+		return 0, false
+	}
+	if syntax.IsCode != nil && syntax.IsCode(line, kernel.isDefined) {
+		return 0, false
+	}
+	return kind, true
+}
+
+// cutLiteralEscape removes the LiteralEscape from a trimmed line that would otherwise look like a
+// special command, or like an escaped line itself.
+func cutLiteralEscape(syntax *Syntax, line string) (string, bool) {
+	if syntax.LiteralEscape == "" {
+		return line, false
+	}
+	rest, ok := strings.CutPrefix(line, syntax.LiteralEscape)
+	if !ok || rest == "" {
+		return line, false
+	}
+	if strings.IndexByte("%$!", rest[0]) >= 0 || shellAssignment.MatchString(rest) || strings.HasPrefix(rest, syntax.LiteralEscape) {
+		return rest, true
+	}
+	return line, false
+}
+
+// lexer follows string literals, comments and brackets across the lines of a cell.
+type lexer struct {
+	syntax *Syntax
+
+	// quote is the multi-line string literal the lexer is in, or nil.
+	quote *Quote
+
+	// quoteStart is the offset of the contents of quote in the last line, or -1 if the literal
+	// started on an earlier line.
+	quoteStart int
+
+	// comment is the end delimiter of the block comment the lexer is in, or "".
+	comment string
+
+	// depth is the number of open brackets.
+	depth int
+}
+
+// atTopLevel reports whether the next line starts outside of literals, comments and brackets.
+func (l *lexer) atTopLevel() bool {
+	return l.quote == nil && l.comment == "" && l.depth == 0
+}
+
+// scanLine advances the lexer over a line of code.
+func (l *lexer) scanLine(line string) {
+	l.scan(line)
+	if l.quote != nil && !l.quote.Multiline {
+		// unterminated single-line literal: the line is invalid, start afresh
+		l.quote = nil
+	}
+}
+
+// scan advances the lexer over a line, or the beginning of a line.
+func (l *lexer) scan(line string) {
+	l.quoteStart = -1
+	for i := 0; i < len(line); {
+		switch {
+		case l.comment != "":
+			end := strings.Index(line[i:], l.comment)
+			if end < 0 {
+				return
+			}
+			i += end + len(l.comment)
+			l.comment = ""
+		case l.quote != nil:
+			end, closed := l.scanQuote(line[i:], l.quote)
+			i += end
+			if closed {
+				l.quote = nil
+			}
+		default:
+			i = l.scanCode(line, i)
+		}
+	}
+}
+
+// scanCode advances over code starting at line[i] up to the next literal or comment, and returns
+// the index following it.
+func (l *lexer) scanCode(line string, i int) int {
+	for ; i < len(line); i++ {
+		rest := line[i:]
+		for _, prefix := range l.syntax.LineComments {
+			if strings.HasPrefix(rest, prefix) {
+				return len(line)
+			}
+		}
+		for _, delims := range l.syntax.BlockComments {
+			if strings.HasPrefix(rest, delims[0]) {
+				l.comment = delims[1]
+				return i + len(delims[0])
+			}
+		}
+		for j := range l.syntax.Strings {
+			if q := &l.syntax.Strings[j]; strings.HasPrefix(rest, q.Delim) {
+				l.quote, l.quoteStart = q, i+len(q.Delim)
+				return i + len(q.Delim)
+			}
+		}
+		for _, brackets := range l.syntax.Brackets {
+			switch line[i] {
+			case brackets[0]:
+				l.depth++
+			case brackets[1]:
+				if l.depth > 0 {
+					l.depth--
+				}
+			}
+		}
+	}
+	return i
+}
+
+// scanQuote returns the length of the part of s within the literal q, including its closing
+// delimiter, and whether the literal was closed.
+func (l *lexer) scanQuote(s string, q *Quote) (int, bool) {
+	for i := 0; i < len(s); i++ {
+		if !q.Raw && s[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.HasPrefix(s[i:], q.Delim) {
+			return i + len(q.Delim), true
+		}
+	}
+	return len(s), false
+}
@@ -0,0 +1,50 @@
+package jupyter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestSplitSpecialCommands tests that special commands are found outside literals, comments and brackets, and
+// that `!` lines are code only when they parse as Go and use variables of the interpreter.
+func TestSplitSpecialCommands(t *testing.T) {
+	kernel := &Kernel{ir: testInterpreter{}, opts: defaultKernelOptions()}
+
+	tests := []struct {
+		code string
+		want []segment
+	}{
+		{"x\n%lsmagic\ny\nz", []segment{{segmentCode, "x", 0}, {segmentMagic, "%lsmagic", 1}, {segmentCode, "y\nz", 2}}},
+		{"s := `\n%raw\n`", []segment{{segmentCode, "s := `\n%raw\n`", 0}}},
+		{"/* \n$ls\n*/ x", []segment{{segmentCode, "/* \n$ls\n*/ x", 0}}},
+		{"f(a, // )\n!ok)", []segment{{segmentCode, "f(a, // )\n!ok)", 0}}},
+		{`s := "it's ("` + "\n  $ls *.go", []segment{{segmentCode, `s := "it's ("`, 0}, {segmentShell, "$ls *.go", 1}}},
+		{"!ok\n!(answer > 1)\n!ls\n!ls -l\n!pwd\n!!ok", []segment{
+			{segmentCode, "!ok\n!(answer > 1)", 0}, {segmentShell, "!ls", 2}, {segmentShell, "!ls -l", 3}, {segmentShell, "!pwd", 4}, {segmentShell, "!!ok", 5},
+		}},
+		{"ok = !ok\nx = !true\ndir = !pwd\nfiles = !!ls\nlines = !ls *.go", []segment{
+			{segmentCode, "ok = !ok\nx = !true", 0}, {segmentShellAssignment, "dir = !pwd", 2},
+			{segmentShellAssignment, "files = !!ls", 3}, {segmentShellAssignment, "lines = !ls *.go", 4},
+		}},
+		{"\\%literal\n\\\\x\n\\x", []segment{{segmentCode, "%literal\n\\x\n\\x", 0}}},
+	}
+
+	for _, test := range tests {
+		if got := kernel.splitSpecialCommands(test.code); !reflect.DeepEqual(got, test.want) {
+			t.Fatalf("\t%s splitSpecialCommands(%q) = %+v, want %+v", failure, test.code, got, test.want)
+		}
+	}
+	t.Logf("\t%s Special commands were found.", success)
+}
+
+// TestSpecialCommandsInOrder tests that special commands after code run in order with it.
+func TestSpecialCommandsInOrder(t *testing.T) {
+	_, client := startTestKernel(t, WithPty(false))
+
+	stdout, _ := testOutputStreamFor(t, client, "ctxprint(\"a\\n\")\n!echo b\nctxprint(\"c\\n\")\n%cd .\nctxprint(\"d\\n\")")
+	if out := strings.Join(stdout, ""); out != "a\nb\nc\nd\n" {
+		t.Fatalf("\t%s Unexpected output %q", failure, out)
+	}
+	t.Logf("\t%s Special commands ran in order.", success)
+}
@@ -0,0 +1,445 @@
+package jupyter
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// PrettyOptions configures the text/plain representation of the values returned by cells which
+// are not rendered otherwise.
+type PrettyOptions struct {
+	// Indent is the indentation of each level of nested values written on several lines.
+	Indent string
+
+	// MaxWidth is the width up to which a nested value is written on a single line. Zero writes
+	// every value on a single line.
+	MaxWidth int
+
+	// MaxDepth is the number of levels of nested values that are written; deeper values are
+	// elided. Zero disables the limit.
+	MaxDepth int
+
+	// MaxItems is the number of elements, entries or fields written for each slice, map or
+	// struct; the others are counted. Zero disables the limit.
+	MaxItems int
+
+	// MaxStringLength is the number of bytes written of a nested string. Zero disables the limit.
+	MaxStringLength int
+
+	// Color highlights the output with ANSI escape sequences, which the Jupyter front-ends
+	// render in text/plain results. The escapes are saved in notebooks with the results, so
+	// disable Color for front-ends or tools that don't render them.
+	Color bool
+}
+
+// DefaultPrettyOptions is the pretty-printing applied to the results of cells unless configured
+// otherwise.
+var DefaultPrettyOptions = PrettyOptions{
+	Indent:          "  ",
+	MaxWidth:        80,
+	MaxDepth:        6,
+	MaxItems:        100,
+	MaxStringLength: 500,
+	Color:           true,
+}
+
+// ANSI colors of the parts of pretty-printed values.
+const (
+	colorReset  = "\x1b[0m"
+	colorType   = "\x1b[90m"
+	colorString = "\x1b[32m"
+	colorNumber = "\x1b[34m"
+	colorConst  = "\x1b[35m"
+	colorNote   = "\x1b[2m"
+)
+
+// Format returns the multi-line, structured representation of value. Structs, maps and slices are
+// written with their type and contents, maps sorted by key, and pointers are followed. Strings
+// and the values implementing fmt.Stringer or error are written as is at the top level.
+func (opts PrettyOptions) Format(value any) string {
+	switch x := value.(type) {
+	case string:
+		return x
+	case error:
+		if s, ok := safeString(x.Error); ok {
+			return s
+		}
+	case fmt.Stringer:
+		if s, ok := safeString(x.String); ok {
+			return s
+		}
+	}
+
+	p := &prettyPrinter{opts: opts, visiting: make(map[prettyRef]bool)}
+	var sb strings.Builder
+	p.layout(&sb, p.node(reflect.ValueOf(value), 0, false), 0, 0)
+	return sb.String()
+}
+
+// safeString calls fn, which may panic, like the String method of a value with a nil field.
+func safeString(fn func() string) (s string, ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	return fn(), true
+}
+
+// prettyNode is a formatted value before it is laid out on one or several lines.
+type prettyNode struct {
+	// text is the whole text of a scalar, or what precedes the items of a composite value, like
+	// its type and opening brace.
+	text string
+
+	// items are the elements, entries or fields of a composite value.
+	items []prettyItem
+
+	// close ends a composite value, like its closing brace. It is empty for scalars.
+	close string
+}
+
+// prettyItem is an element, entry or field of a composite value.
+type prettyItem struct {
+	// key precedes the value, like the name of a field and a colon.
+	key   string
+	value *prettyNode
+}
+
+// prettyPrinter formats values for PrettyOptions.Format.
+type prettyPrinter struct {
+	opts PrettyOptions
+
+	// visiting holds the pointers, maps and slices being formatted, to detect cycles.
+	visiting map[prettyRef]bool
+}
+
+// prettyRef identifies a pointer, map or slice by its address and type: a pointer to a struct and
+// a pointer to its first field have the same address, but don't form a cycle.
+type prettyRef struct {
+	addr uintptr
+	typ  reflect.Type
+}
+
+// color wraps s in the ANSI color code if colors are enabled.
+func (p *prettyPrinter) color(code, s string) string {
+	if !p.opts.Color || s == "" {
+		return s
+	}
+	return code + s + colorReset
+}
+
+// leaf returns a scalar node.
+func leaf(text string) *prettyNode {
+	return &prettyNode{text: text}
+}
+
+// node formats v at the given depth. If elided, the type of v is the one of the elements of its
+// container and is not repeated.
+func (p *prettyPrinter) node(v reflect.Value, depth int, elided bool) *prettyNode {
+	if !v.IsValid() {
+		return leaf(p.color(colorConst, "nil"))
+	}
+
+	if v.CanInterface() && v.Kind() != reflect.Interface && !(v.Kind() == reflect.Pointer && v.IsNil()) {
+		switch x := v.Interface().(type) {
+		case error:
+			if s, ok := safeString(x.Error); ok {
+				return leaf(s)
+			}
+		case fmt.Stringer:
+			if s, ok := safeString(x.String); ok {
+				return leaf(s)
+			}
+		}
+	}
+
+	t := v.Type()
+	switch v.Kind() {
+	case reflect.Bool:
+		return leaf(p.color(colorConst, strconv.FormatBool(v.Bool())))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return leaf(p.color(colorNumber, strconv.FormatInt(v.Int(), 10)))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return leaf(p.color(colorNumber, strconv.FormatUint(v.Uint(), 10)))
+	case reflect.Float32, reflect.Float64:
+		return leaf(p.color(colorNumber, strconv.FormatFloat(v.Float(), 'g', -1, t.Bits())))
+	case reflect.Complex64, reflect.Complex128:
+		return leaf(p.color(colorNumber, strconv.FormatComplex(v.Complex(), 'g', -1, t.Bits())))
+	case reflect.String:
+		return leaf(p.quote(v.String()))
+	case reflect.Interface:
+		return p.node(v.Elem(), depth, false)
+	case reflect.Pointer:
+		if v.IsNil() {
+			return leaf(p.color(colorType, "("+t.String()+")") + "(" + p.color(colorConst, "nil") + ")")
+		}
+		if p.visiting[prettyRef{v.Pointer(), t}] {
+			return leaf(p.color(colorNote, "<cycle "+t.String()+">"))
+		}
+		p.visiting[prettyRef{v.Pointer(), t}] = true
+		defer delete(p.visiting, prettyRef{v.Pointer(), t})
+
+		n := *p.node(v.Elem(), depth, false)
+		n.text = "&" + n.text
+		return &n
+	case reflect.Struct:
+		return p.structNode(v, depth, elided)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice {
+			if v.IsNil() {
+				return leaf(p.color(colorType, t.String()) + "(" + p.color(colorConst, "nil") + ")")
+			}
+			if v.Len() > 0 {
+				if p.visiting[prettyRef{v.Pointer(), t}] {
+					return leaf(p.color(colorNote, "<cycle "+t.String()+">"))
+				}
+				p.visiting[prettyRef{v.Pointer(), t}] = true
+				defer delete(p.visiting, prettyRef{v.Pointer(), t})
+			}
+		}
+		return p.listNode(v, depth, elided)
+	case reflect.Map:
+		if v.IsNil() {
+			return leaf(p.color(colorType, t.String()) + "(" + p.color(colorConst, "nil") + ")")
+		}
+		if p.visiting[prettyRef{v.Pointer(), t}] {
+			return leaf(p.color(colorNote, "<cycle "+t.String()+">"))
+		}
+		p.visiting[prettyRef{v.Pointer(), t}] = true
+		defer delete(p.visiting, prettyRef{v.Pointer(), t})
+		return p.mapNode(v, depth, elided)
+	}
+
+	// Channels, functions and unsafe pointers.
+	if v.IsNil() {
+		return leaf(p.color(colorType, "("+t.String()+")") + "(" + p.color(colorConst, "nil") + ")")
+	}
+	return leaf(p.color(colorType, "("+t.String()+")") + fmt.Sprintf("(%#x)", v.Pointer()))
+}
+
+// quote returns the quoted string s, truncated to MaxStringLength.
+func (p *prettyPrinter) quote(s string) string {
+	max := p.opts.MaxStringLength
+	if max <= 0 || len(s) <= max {
+		return p.color(colorString, strconv.Quote(s))
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return p.color(colorString, strconv.Quote(s[:cut])) + p.color(colorNote, fmt.Sprintf("… (%d bytes)", len(s)))
+}
+
+// head returns the text preceding the items of a composite value of type t: its type, unless
+// elided, an optional note, and the opening brace.
+func (p *prettyPrinter) head(t reflect.Type, note string, elided bool) string {
+	if elided {
+		return "{"
+	}
+	head := p.color(colorType, t.String())
+	if note != "" {
+		head += " " + p.color(colorNote, note) + " "
+	}
+	return head + "{"
+}
+
+// truncated returns the note item counting the items that are not written, or nil.
+func (p *prettyPrinter) truncated(items []prettyItem, n int) []prettyItem {
+	if max := p.opts.MaxItems; max > 0 && n > max {
+		return append(items, prettyItem{value: leaf(p.color(colorNote, fmt.Sprintf("… %d more", n-max)))})
+	}
+	return items
+}
+
+// limit returns the number of items written out of n.
+func (p *prettyPrinter) limit(n int) int {
+	if max := p.opts.MaxItems; max > 0 && n > max {
+		return max
+	}
+	return n
+}
+
+// tooDeep reports whether the contents of a composite value at the depth are elided.
+func (p *prettyPrinter) tooDeep(depth int) bool {
+	return p.opts.MaxDepth > 0 && depth >= p.opts.MaxDepth
+}
+
+// elidesType reports whether the elements of type t of a container don't repeat their type.
+func elidesType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Struct, reflect.Slice, reflect.Array, reflect.Map:
+		return true
+	}
+	return false
+}
+
+func (p *prettyPrinter) structNode(v reflect.Value, depth int, elided bool) *prettyNode {
+	t := v.Type()
+	n := &prettyNode{text: p.head(t, "", elided), close: "}"}
+	if t.NumField() == 0 {
+		return n
+	}
+	if p.tooDeep(depth) {
+		n.items = []prettyItem{{value: leaf(p.color(colorNote, "…"))}}
+		return n
+	}
+
+	for i := 0; i < p.limit(t.NumField()); i++ {
+		f := t.Field(i)
+		n.items = append(n.items, prettyItem{
+			key:   f.Name + ": ",
+			value: p.node(v.Field(i), depth+1, false),
+		})
+	}
+	n.items = p.truncated(n.items, t.NumField())
+	return n
+}
+
+func (p *prettyPrinter) listNode(v reflect.Value, depth int, elided bool) *prettyNode {
+	t := v.Type()
+	note := ""
+	if v.Kind() == reflect.Slice {
+		note = fmt.Sprintf("(len %d)", v.Len())
+	}
+	n := &prettyNode{text: p.head(t, note, elided), close: "}"}
+	if v.Len() == 0 {
+		return n
+	}
+	if p.tooDeep(depth) {
+		n.items = []prettyItem{{value: leaf(p.color(colorNote, "…"))}}
+		return n
+	}
+
+	elideElems := elidesType(t.Elem())
+	for i := 0; i < p.limit(v.Len()); i++ {
+		n.items = append(n.items, prettyItem{value: p.node(v.Index(i), depth+1, elideElems)})
+	}
+	n.items = p.truncated(n.items, v.Len())
+	return n
+}
+
+func (p *prettyPrinter) mapNode(v reflect.Value, depth int, elided bool) *prettyNode {
+	t := v.Type()
+	n := &prettyNode{text: p.head(t, fmt.Sprintf("(len %d)", v.Len()), elided), close: "}"}
+	if v.Len() == 0 {
+		return n
+	}
+	if p.tooDeep(depth) {
+		n.items = []prettyItem{{value: leaf(p.color(colorNote, "…"))}}
+		return n
+	}
+
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool { return lessKey(keys[i], keys[j]) })
+
+	elideKeys, elideValues := elidesType(t.Key()), elidesType(t.Elem())
+	for _, key := range keys[:p.limit(len(keys))] {
+		var sb strings.Builder
+		p.layoutFlat(&sb, p.node(key, depth+1, elideKeys))
+		n.items = append(n.items, prettyItem{
+			key:   sb.String() + ": ",
+			value: p.node(v.MapIndex(key), depth+1, elideValues),
+		})
+	}
+	n.items = p.truncated(n.items, len(keys))
+	return n
+}
+
+// lessKey orders the keys of a map: numbers, strings and booleans by value, others by their
+// formatting.
+func lessKey(a, b reflect.Value) bool {
+	for a.Kind() == reflect.Interface && !a.IsNil() {
+		a = a.Elem()
+	}
+	for b.Kind() == reflect.Interface && !b.IsNil() {
+		b = b.Elem()
+	}
+	if a.Kind() == b.Kind() {
+		switch a.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return a.Int() < b.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return a.Uint() < b.Uint()
+		case reflect.Float32, reflect.Float64:
+			return a.Float() < b.Float()
+		case reflect.String:
+			return a.String() < b.String()
+		case reflect.Bool:
+			return !a.Bool() && b.Bool()
+		}
+	} else if a.IsValid() && b.IsValid() && a.Kind() != b.Kind() {
+		return a.Kind() < b.Kind()
+	}
+	return fmt.Sprint(a) < fmt.Sprint(b)
+}
+
+// layout writes n at the indentation level, after `prefix` columns of the line, on a single line
+// if it fits within MaxWidth.
+func (p *prettyPrinter) layout(sb *strings.Builder, n *prettyNode, level, prefix int) {
+	if n.items == nil || p.fits(n, level, prefix) {
+		p.layoutFlat(sb, n)
+		return
+	}
+
+	indent := strings.Repeat(p.opts.Indent, level+1)
+	sb.WriteString(n.text)
+	sb.WriteByte('\n')
+	for _, item := range n.items {
+		sb.WriteString(indent)
+		sb.WriteString(item.key)
+		p.layout(sb, item.value, level+1, visibleWidth(item.key))
+		sb.WriteString(",\n")
+	}
+	sb.WriteString(strings.Repeat(p.opts.Indent, level))
+	sb.WriteString(n.close)
+}
+
+// layoutFlat writes n on a single line.
+func (p *prettyPrinter) layoutFlat(sb *strings.Builder, n *prettyNode) {
+	sb.WriteString(n.text)
+	for i, item := range n.items {
+		if i != 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(item.key)
+		p.layoutFlat(sb, item.value)
+	}
+	sb.WriteString(n.close)
+}
+
+// fits reports whether n fits on a single line at the indentation level, after `prefix` columns.
+func (p *prettyPrinter) fits(n *prettyNode, level, prefix int) bool {
+	var sb strings.Builder
+	p.layoutFlat(&sb, n)
+	if strings.ContainsRune(sb.String(), '\n') {
+		return false
+	}
+	if p.opts.MaxWidth <= 0 {
+		return true
+	}
+	width := visibleWidth(strings.Repeat(p.opts.Indent, level)) + prefix + visibleWidth(sb.String())
+	return width <= p.opts.MaxWidth
+}
+
+// visibleWidth returns the number of runes of s, not counting ANSI escape sequences.
+func visibleWidth(s string) int {
+	width := 0
+	for i := 0; i < len(s); {
+		if strings.HasPrefix(s[i:], "\x1b[") {
+			end := strings.IndexByte(s[i:], 'm')
+			if end >= 0 {
+				i += end + 1
+				continue
+			}
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		width++
+	}
+	return width
+}
@@ -0,0 +1,135 @@
+package jupyter
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testOrder struct {
+	ID       int
+	Customer *testCustomer
+	Items    []string
+	Prices   map[string]float64
+	note     string
+}
+
+type testCustomer struct {
+	Name     string
+	Referrer *testCustomer
+}
+
+type testFirstField struct {
+	X int
+	P *int
+}
+
+type testList struct {
+	Value int
+	Next  *testList
+}
+
+// TestPrettyFormat tests that values are written with their type and contents, on several lines when
+// they are too wide, and that cycles are elided.
+func TestPrettyFormat(t *testing.T) {
+	opts := DefaultPrettyOptions
+	opts.Color = false
+
+	cycle := &testList{Value: 1}
+	cycle.Next = &testList{Value: 2, Next: cycle}
+
+	selfMap := map[string]any{"a": 1}
+	selfMap["self"] = selfMap
+
+	// A pointer to the first field has the address of the struct, without forming a cycle.
+	first := &testFirstField{X: 1}
+	first.P = &first.X
+
+	cases := []struct {
+		value any
+		want  string
+	}{
+		{"top-level text", "top-level text"},
+		{42, "42"},
+		{3.5, "3.5"},
+		{nil, "nil"},
+		{errors.New("boom"), "boom"},
+		{[]string{"x", "y y"}, `[]string (len 2) {"x", "y y"}`},
+		{[]int(nil), "[]int(nil)"},
+		{(*testCustomer)(nil), "(*jupyter.testCustomer)(nil)"},
+		{[2]bool{true, false}, "[2]bool{true, false}"},
+		{map[int]string{10: "ten", 2: "two", -1: "minus one"}, `map[int]string (len 3) {-1: "minus one", 2: "two", 10: "ten"}`},
+		{struct{ D time.Duration }{1500 * time.Millisecond}, "struct { D time.Duration }{D: 1.5s}"},
+		{[][]int{{1, 2}, {3}}, "[][]int (len 2) {{1, 2}, {3}}"},
+		{cycle, `&jupyter.testList{
+  Value: 1,
+  Next: &jupyter.testList{Value: 2, Next: <cycle *jupyter.testList>},
+}`},
+		{first, "&jupyter.testFirstField{X: 1, P: &1}"},
+		{selfMap, `map[string]interface {} (len 2) {
+  "a": 1,
+  "self": <cycle map[string]interface {}>,
+}`},
+		{
+			testOrder{
+				ID:       7,
+				Customer: &testCustomer{Name: "Ada", Referrer: &testCustomer{Name: "Charles"}},
+				Items:    []string{"keyboard", "mouse", "a rather long name of an item"},
+				Prices:   map[string]float64{"mouse": 25, "keyboard": 99.5},
+				note:     "unexported",
+			},
+			`jupyter.testOrder{
+  ID: 7,
+  Customer: &jupyter.testCustomer{
+    Name: "Ada",
+    Referrer: &jupyter.testCustomer{
+      Name: "Charles",
+      Referrer: (*jupyter.testCustomer)(nil),
+    },
+  },
+  Items: []string (len 3) {"keyboard", "mouse", "a rather long name of an item"},
+  Prices: map[string]float64 (len 2) {"keyboard": 99.5, "mouse": 25},
+  note: "unexported",
+}`,
+		},
+	}
+	for _, c := range cases {
+		if got := opts.Format(c.value); got != c.want {
+			t.Fatalf("\t%s Format(%T) =\n%s\nwant\n%s", failure, c.value, got, c.want)
+		}
+	}
+	t.Logf("\t%s Values were pretty-printed.", success)
+}
+
+// TestPrettyLimits tests that the limits of depth, items and string length are applied, and that
+// colors highlight the parts of nested values.
+func TestPrettyLimits(t *testing.T) {
+	opts := PrettyOptions{Indent: "  ", MaxDepth: 2, MaxItems: 3, MaxStringLength: 5}
+
+	cases := []struct {
+		value any
+		want  string
+	}{
+		{[]int{1, 2, 3, 4, 5}, "[]int (len 5) {1, 2, 3, … 2 more}"},
+		{[]string{"abcdefgh"}, `[]string (len 1) {"abcde"… (8 bytes)}`},
+		{[][][]int{{{1}}}, "[][][]int (len 1) {{{…}}}"},
+		{map[string]int{"d": 4, "c": 3, "b": 2, "a": 1}, `map[string]int (len 4) {"a": 1, "b": 2, "c": 3, … 1 more}`},
+	}
+	for _, c := range cases {
+		if got := opts.Format(c.value); got != c.want {
+			t.Fatalf("\t%s Format(%#v) = %s, want %s", failure, c.value, got, c.want)
+		}
+	}
+
+	opts.Color = true
+	got := opts.Format([]any{"s", 1, true})
+	want := "\x1b[90m[]interface {}\x1b[0m \x1b[2m(len 3)\x1b[0m {\x1b[32m\"s\"\x1b[0m, \x1b[34m1\x1b[0m, \x1b[35mtrue\x1b[0m}"
+	if got != want {
+		t.Fatalf("\t%s Unexpected colors %q, want %q", failure, got, want)
+	}
+	if strings.Contains(opts.Format("plain"), "\x1b") {
+		t.Fatalf("\t%s Expected top-level strings not to be colored", failure)
+	}
+	t.Logf("\t%s Limits were applied.", success)
+}
@@ -0,0 +1,150 @@
+package jupyter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// errPtyUnsupported is returned by startPty on platforms without pseudo-terminals.
+var errPtyUnsupported = errors.New("pseudo-terminals are not supported on this platform")
+
+// ptyPromptDelay is how long a command in a pseudo-terminal must stay silent after printing an
+// incomplete line before that line is taken for a prompt.
+const ptyPromptDelay = 200 * time.Millisecond
+
+// ptyRows is the height of the pseudo-terminals.
+const ptyRows = 24
+
+// runPty runs cmd in a pseudo-terminal `cols` wide, copying its output to w unchanged. If input
+// is not nil, it is asked for a line to send to the command whenever the command waits at a prompt.
+// Otherwise the command reads from an empty stdin, as without a pseudo-terminal.
+func runPty(ctx context.Context, cmd *exec.Cmd, cols int, w io.Writer, input inputFunc) error {
+	master, err := startPty(cmd, cols, input != nil)
+	if err != nil {
+		return err
+	}
+	defer master.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	copied := make(chan error, 1)
+	go func() {
+		copied <- copyPty(ctx, w, master, input)
+	}()
+
+	err = cmd.Wait()
+
+	// Stop prompting, and stop reading once the output is drained, even if background processes
+	// of the command keep the terminal open.
+	cancel()
+	master.SetReadDeadline(time.Now().Add(captureDrainTimeout))
+	if copyErr := <-copied; err == nil {
+		err = copyErr
+	}
+	return err
+}
+
+// copyPty copies the output of a pseudo-terminal to w until it is closed. When the command prints
+// an incomplete line and then stays silent, input is called with that line as prompt and its
+// result is written to the terminal.
+func copyPty(ctx context.Context, w io.Writer, master *os.File, input inputFunc) error {
+	chunks := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(chunks)
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := master.Read(buf)
+			if n > 0 {
+				chunks <- append([]byte(nil), buf[:n]...)
+			}
+			if err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+
+	var (
+		pending []byte
+		stall   <-chan time.Time
+	)
+	for {
+		select {
+		case chunk, ok := <-chunks:
+			if !ok {
+				// The terminal is closed once the command exits, which reads as EIO.
+				err := <-readErr
+				if errors.Is(err, syscall.EIO) || errors.Is(err, os.ErrDeadlineExceeded) || errors.Is(err, os.ErrClosed) {
+					return nil
+				}
+				return err
+			}
+			if _, err := w.Write(chunk); err != nil {
+				return err
+			}
+
+			if input == nil {
+				continue
+			}
+			if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+				pending, chunk = pending[:0], chunk[i+1:]
+			}
+			pending = append(pending, chunk...)
+			stall = nil
+			if len(pending) != 0 && bytes.IndexByte(pending, '\r') < 0 {
+				// Progress lines rewritten with a carriage return are not prompts.
+				stall = time.After(ptyPromptDelay)
+			}
+
+		case <-stall:
+			stall = nil
+			prompt := string(pending)
+			pending = pending[:0]
+			value, err := input(ctx, "", isPasswordPrompt(prompt))
+			if err != nil {
+				if ctx.Err() == nil {
+					fmt.Fprintf(w, "\nerror reading input: %v\n", err)
+				}
+				continue
+			}
+			if _, err := master.WriteString(value + "\n"); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// isPasswordPrompt reports whether a prompt asks for a secret that should not be echoed by the
+// front-end.
+func isPasswordPrompt(prompt string) bool {
+	prompt = strings.ToLower(prompt)
+	return strings.Contains(prompt, "password") || strings.Contains(prompt, "passphrase")
+}
+
+// terminalEnv returns the environment of a command run in a terminal `cols` wide, based on env or
+// the environment of the process.
+func terminalEnv(env []string, cols int) []string {
+	if env == nil {
+		env = os.Environ()
+	}
+	term := ""
+	for _, kv := range env {
+		if v, ok := strings.CutPrefix(kv, "TERM="); ok {
+			term = v
+		}
+	}
+	if term == "" || term == "dumb" {
+		env = append(env, "TERM=xterm-256color")
+	}
+	return append(env, fmt.Sprintf("COLUMNS=%d", cols), fmt.Sprintf("LINES=%d", ptyRows))
+}
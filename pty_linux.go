@@ -0,0 +1,85 @@
+//go:build linux
+
+package jupyter
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"unsafe"
+)
+
+// startPty starts cmd with a new pseudo-terminal `cols` wide as its controlling terminal, stdout
+// and stderr, and returns the master side of the terminal. The terminal is also the stdin of cmd
+// if `stdin` is set; otherwise cmd reads from the null device.
+func startPty(cmd *exec.Cmd, cols int, stdin bool) (*os.File, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var unlock int32
+	var n uint32
+	if err = ioctl(master, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err == nil {
+		err = ioctl(master, syscall.TIOCGPTN, unsafe.Pointer(&n))
+	}
+	if err != nil {
+		master.Close()
+		return nil, fmt.Errorf("setting up pseudo-terminal: %w", err)
+	}
+
+	tty, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		master.Close()
+		return nil, err
+	}
+	defer tty.Close()
+
+	// Keep newlines as they are instead of translating them to CRLF, and set the terminal size.
+	var termios syscall.Termios
+	if err = ioctl(tty, syscall.TCGETS, unsafe.Pointer(&termios)); err == nil {
+		termios.Oflag &^= syscall.ONLCR
+		err = ioctl(tty, syscall.TCSETS, unsafe.Pointer(&termios))
+	}
+	if err == nil {
+		size := struct{ rows, cols, x, y uint16 }{ptyRows, uint16(cols), 0, 0}
+		err = ioctl(tty, syscall.TIOCSWINSZ, unsafe.Pointer(&size))
+	}
+	if err != nil {
+		master.Close()
+		return nil, fmt.Errorf("setting up pseudo-terminal: %w", err)
+	}
+
+	cmd.Env = terminalEnv(cmd.Env, cols)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = nil, tty, tty
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 1}
+	if stdin {
+		cmd.Stdin = tty
+		cmd.SysProcAttr.Ctty = 0
+	}
+	if err := cmd.Start(); err != nil {
+		master.Close()
+		return nil, err
+	}
+	return master, nil
+}
+
+// ioctl performs an ioctl on f without switching it to blocking mode, as f.Fd() would.
+func ioctl(f *os.File, req uint, arg unsafe.Pointer) error {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errno syscall.Errno
+	err = conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, uintptr(req), uintptr(arg))
+	})
+	if err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
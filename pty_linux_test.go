@@ -0,0 +1,92 @@
+//go:build linux
+
+package jupyter
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+)
+
+// TestShellPty tests that shell commands run in a pseudo-terminal, with their output passed through and an
+// empty stdin.
+func TestShellPty(t *testing.T) {
+	_, client := startTestKernel(t, WithTerminalWidth(100))
+
+	stdout, stderr := testOutputStreamFor(t, client, `!test -t 1 && stty size </dev/tty && printf 'a\rb\n\033[31mred\033[0m\n' && echo err >&2`)
+	if out := strings.Join(stdout, ""); out != "24 100\na\rb\n\x1b[31mred\x1b[0m\nerr\n" || len(stderr) != 0 {
+		t.Fatalf("\t%s Unexpected output in pseudo-terminal %q %q", failure, out, stderr)
+	}
+
+	// Without stdin wiring, commands reading their stdin must see its end instead of waiting forever.
+	content, pub := client.executeCode(t, "!cat")
+	if status := getString(t, "content", content, "status"); status != "ok" {
+		t.Fatalf("\t%s Expected the command to succeed", failure)
+	}
+	if results := testResults(t, pub); len(results) != 0 {
+		t.Fatalf("\t%s Unexpected results %q", failure, results)
+	}
+	t.Logf("\t%s Shell commands ran in a pseudo-terminal.", success)
+}
+
+// TestShellStdin tests that prompts of shell commands are answered through the stdin channel.
+func TestShellStdin(t *testing.T) {
+	_, client := startTestKernel(t, WithShellStdin(true))
+
+	answered := make(chan map[string]interface{}, 1)
+	go func() {
+		msg, err := client.stdinSocket.Recv()
+		if err != nil {
+			t.Errorf("\t%s stdin.Recv: %s", failure, err)
+			return
+		}
+		request, _, err := WireMsgToComposedMsg(msg.Frames, []byte(connectionKey))
+		if err != nil {
+			t.Errorf("\t%s Could not parse wire message: %s", failure, err)
+			return
+		}
+
+		reply, err := NewMsg("input_reply", request)
+		if err != nil {
+			t.Errorf("\t%s NewMsg: %s", failure, err)
+			return
+		}
+		reply.Content = map[string]interface{}{"value": "gopher"}
+		parts, err := reply.ToWireMsg([]byte(connectionKey))
+		if err != nil {
+			t.Errorf("\t%s ToWireMsg: %s", failure, err)
+			return
+		}
+		if err := client.stdinSocket.SendMulti(zmq4.NewMsgFrom(append([][]byte{[]byte("<IDS|MSG>")}, parts...)...)); err != nil {
+			t.Errorf("\t%s stdin.Send: %s", failure, err)
+			return
+		}
+		answered <- request.Content.(map[string]interface{})
+	}()
+
+	request := client.newExecuteRequest(t, `!read -p "Password: " x && echo "hello $x"`)
+	request.Content.(map[string]interface{})["allow_stdin"] = true
+	_, pub := client.performJupyterRequest(t, request, 10*time.Second)
+
+	select {
+	case content := <-answered:
+		if content["password"] != true {
+			t.Fatalf("\t%s Expected a password input request but got %v", failure, content)
+		}
+	default:
+		t.Fatalf("\t%s No input request was sent", failure)
+	}
+
+	var out strings.Builder
+	for _, msg := range pub {
+		if msg.Header.MsgType == "stream" {
+			out.WriteString(getString(t, "content", getMsgContentAsJSONObject(t, msg), "text"))
+		}
+	}
+	if !strings.HasPrefix(out.String(), "Password: ") || !strings.HasSuffix(out.String(), "hello gopher\n") {
+		t.Fatalf("\t%s Unexpected output %q", failure, out.String())
+	}
+	t.Logf("\t%s A prompt was answered through the stdin channel.", success)
+}
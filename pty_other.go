@@ -0,0 +1,13 @@
+//go:build !linux
+
+package jupyter
+
+import (
+	"os"
+	"os/exec"
+)
+
+// startPty is not supported on this platform; shell commands run with pipes.
+func startPty(cmd *exec.Cmd, cols int, stdin bool) (*os.File, error) {
+	return nil, errPtyUnsupported
+}
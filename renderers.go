@@ -0,0 +1,170 @@
+package jupyter
+
+import (
+	"reflect"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// RenderFunc renders a value, reporting false if it does not handle the value.
+type RenderFunc func(value any) (Data, bool)
+
+// ExternalRenderer displays values of types that cannot implement the renderer interfaces, such
+// as types of third-party libraries.
+type ExternalRenderer struct {
+	// Type, if not nil, restricts the renderer to values of this type, or to values implementing
+	// it if it is an interface type. If nil, Render is called with every value.
+	Type reflect.Type
+
+	// Render renders a value.
+	Render RenderFunc
+
+	// Priority orders the renderers: those of higher priority are tried first. Renderers of the
+	// same priority are tried in the order they were registered.
+	Priority int
+
+	// MIMETypes, if not empty, restricts the representations taken from the renderer: it then
+	// overrides these representations of the value and their metadata, and the other ones come
+	// from the renderers of lower priority and the renderer interfaces. Otherwise the first
+	// renderer handling a value renders it alone.
+	MIMETypes []string
+}
+
+// matches reports whether the renderer may render values of type t.
+func (er *ExternalRenderer) matches(t reflect.Type) bool {
+	switch {
+	case er.Type == nil:
+		return true
+	case t == nil:
+		return false
+	case er.Type.Kind() == reflect.Interface:
+		return t.Implements(er.Type)
+	}
+	return t == er.Type
+}
+
+// RendererRegistry holds the external renderers of a Kernel.
+type RendererRegistry struct {
+	mu        sync.RWMutex
+	renderers []ExternalRenderer
+}
+
+// NewRendererRegistry creates an empty RendererRegistry.
+func NewRendererRegistry() *RendererRegistry {
+	return &RendererRegistry{}
+}
+
+// Register adds `er` to the registry.
+func (r *RendererRegistry) Register(er ExternalRenderer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.renderers = append(r.renderers, er)
+	sort.SliceStable(r.renderers, func(i, j int) bool { return r.renderers[i].Priority > r.renderers[j].Priority })
+}
+
+// RegisterType adds a renderer of the values of type t.
+func (r *RendererRegistry) RegisterType(t reflect.Type, render func(value any) Data) {
+	r.Register(ExternalRenderer{
+		Type:   t,
+		Render: func(value any) (Data, bool) { return render(value), true },
+	})
+}
+
+// RegisterFunc adds a renderer deciding itself which values it renders.
+func (r *RendererRegistry) RegisterFunc(render RenderFunc) {
+	r.Register(ExternalRenderer{Render: render})
+}
+
+// Unregister removes the renderers of type t, or the renderers without a type if t is nil.
+func (r *RendererRegistry) Unregister(t reflect.Type) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	kept := r.renderers[:0]
+	for _, er := range r.renderers {
+		if er.Type != t {
+			kept = append(kept, er)
+		}
+	}
+	r.renderers = kept
+}
+
+// Renderers returns the registered renderers, in the order they are tried.
+func (r *RendererRegistry) Renderers() []ExternalRenderer {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]ExternalRenderer(nil), r.renderers...)
+}
+
+// render renders value with the registered renderers. It reports whether any renderer handled
+// the value, and whether a renderer without MIMETypes did, which completes the rendering.
+func (r *RendererRegistry) render(value any) (data Data, ok, complete bool) {
+	t := reflect.TypeOf(value)
+	for _, er := range r.Renderers() {
+		if !er.matches(t) {
+			continue
+		}
+		rendered, handled := safeRender(func() (Data, bool) { return er.Render(value) })
+		if !handled {
+			continue
+		}
+		ok = true
+		if len(er.MIMETypes) == 0 {
+			mergeData(&data, rendered, nil)
+			return data, true, true
+		}
+		mergeData(&data, rendered, er.MIMETypes)
+	}
+	return data, ok, false
+}
+
+// safeRender returns the result of render, or false if it panics, so that a faulty renderer falls
+// back to the other renderings instead of crashing the kernel.
+func safeRender(render func() (Data, bool)) (data Data, ok bool) {
+	defer func() {
+		if recover() != nil {
+			data, ok = Data{}, false
+		}
+	}()
+	return render()
+}
+
+// mergeData adds the representations and metadata of `from` to `to`, without replacing those it
+// already has. If mimeTypes is not nil, only these representations are added.
+func mergeData(to *Data, from Data, mimeTypes []string) {
+	if to.Data == nil {
+		to.Data = make(MIMEMap)
+	}
+	add := func(dst *MIMEMap, key string, value any) {
+		if *dst == nil {
+			*dst = make(MIMEMap)
+		}
+		if _, ok := (*dst)[key]; !ok {
+			(*dst)[key] = value
+		}
+	}
+
+	for mimeType, value := range from.Data {
+		if mimeTypes == nil || slices.Contains(mimeTypes, mimeType) {
+			add(&to.Data, mimeType, value)
+		}
+	}
+	for key, value := range from.Metadata {
+		if mimeTypes == nil || slices.Contains(mimeTypes, key) {
+			add(&to.Metadata, key, value)
+		}
+	}
+	for key, value := range from.Transient {
+		add(&to.Transient, key, value)
+	}
+}
+
+// RegisterRenderer adds an external renderer to the kernel.
+func (kernel *Kernel) RegisterRenderer(er ExternalRenderer) {
+	kernel.renderers.Register(er)
+}
+
+// Renderers returns the external renderers of the kernel.
+func (kernel *Kernel) Renderers() *RendererRegistry {
+	return kernel.renderers
+}
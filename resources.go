@@ -0,0 +1,160 @@
+package jupyter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"runtime/metrics"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// registerResourceMagics adds the magics managing the resources of cells.
+func (kernel *Kernel) registerResourceMagics() {
+	kernel.magics.RegisterLine("timeout", "[duration]", "limit the run time of the rest of the cell, 0 for none, or show the limit", magicTimeout)
+	kernel.magics.SetCompleter("timeout", CompleteNothing)
+}
+
+// ErrCellTimeout is wrapped by the error of a cell that ran longer than its timeout.
+var ErrCellTimeout = errors.New("cell timed out")
+
+// cellTimeout cancels the context of a cell when its timeout expires. The timeout may be changed
+// while the cell runs, with `%timeout`.
+type cellTimeout struct {
+	mu      sync.Mutex
+	cancel  context.CancelCauseFunc
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+// newCellTimeout starts the timeout of a cell, which never expires if `timeout` is zero.
+func newCellTimeout(cancel context.CancelCauseFunc, timeout time.Duration) *cellTimeout {
+	t := &cellTimeout{cancel: cancel}
+	t.set(timeout)
+	return t
+}
+
+// set restarts the timeout of the cell from now, or removes it if `timeout` is zero.
+func (t *cellTimeout) set(timeout time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	t.timeout = timeout
+	if timeout > 0 {
+		t.timer = time.AfterFunc(timeout, func() {
+			t.cancel(fmt.Errorf("%w after %v", ErrCellTimeout, timeout))
+		})
+	}
+}
+
+// get returns the current timeout of the cell, or zero if there is none.
+func (t *cellTimeout) get() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.timeout
+}
+
+// stop removes the timeout once the cell is over.
+func (t *cellTimeout) stop() {
+	t.set(0)
+}
+
+// magicTimeout implements `%timeout [duration]`. The duration is a Go duration like 1m30s, or a
+// number of seconds.
+func magicTimeout(mc *MagicContext, args []string) ([]any, error) {
+	if mc.timeout == nil {
+		return nil, fmt.Errorf("%%timeout: not running in a cell")
+	}
+	switch len(args) {
+	case 0:
+		if timeout := mc.timeout.get(); timeout > 0 {
+			fmt.Fprintf(mc.Stdout, "timeout: %v\n", timeout)
+		} else {
+			fmt.Fprintln(mc.Stdout, "timeout: none")
+		}
+		return nil, nil
+	case 1:
+	default:
+		return nil, fmt.Errorf("%%timeout: too many arguments")
+	}
+
+	timeout, err := time.ParseDuration(args[0])
+	if err != nil {
+		seconds, serr := strconv.ParseFloat(args[0], 64)
+		if serr != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+			return nil, fmt.Errorf("%%timeout: invalid duration %q", args[0])
+		}
+		timeout = time.Duration(seconds * float64(time.Second))
+	}
+	if timeout < 0 {
+		return nil, fmt.Errorf("%%timeout: negative duration %q", args[0])
+	}
+	mc.timeout.set(timeout)
+	return nil, nil
+}
+
+// memoryWarningRatio is the part of KernelOptions.MemoryLimit the memory of the kernel must reach
+// for a warning to be written to the cell.
+const memoryWarningRatio = 0.9
+
+// memoryCheckInterval is how often the memory of the kernel is checked while a cell runs.
+const memoryCheckInterval = 100 * time.Millisecond
+
+// startMemoryWatch checks the memory of the kernel while a cell runs, if `limit` is not zero. The
+// returned function stops the checks.
+func startMemoryWatch(limit int64, w io.Writer) (stop func()) {
+	if limit <= 0 {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		watchMemory(ctx, limit, w)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// watchMemory writes a warning to w the first time the memory of the kernel approaches `limit`,
+// until ctx is done.
+func watchMemory(ctx context.Context, limit int64, w io.Writer) {
+	ticker := time.NewTicker(memoryCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if used := memoryInUse(); float64(used) >= memoryWarningRatio*float64(limit) {
+			fmt.Fprintf(w, "warning: the kernel uses %s of its memory limit of %s\n", formatBytes(used), formatBytes(uint64(limit)))
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// memoryInUse returns the memory of the Go runtime counted against its memory limit.
+func memoryInUse() uint64 {
+	samples := []metrics.Sample{
+		{Name: "/memory/classes/total:bytes"},
+		{Name: "/memory/classes/heap/released:bytes"},
+	}
+	metrics.Read(samples)
+	for _, s := range samples {
+		if s.Value.Kind() != metrics.KindUint64 {
+			return 0
+		}
+	}
+	return samples[0].Value.Uint64() - samples[1].Value.Uint64()
+}
@@ -0,0 +1,70 @@
+package jupyter
+
+import (
+	"bytes"
+	"context"
+	"runtime/debug"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCellTimeout tests that cells are stopped once they run longer than their timeout, which %timeout
+// changes.
+func TestCellTimeout(t *testing.T) {
+	_, client := startTestKernel(t, WithPty(false), WithCellTimeout(300*time.Millisecond))
+
+	for _, code := range []string{"wait()", "$sleep 10", "%timeout 100ms\nwait()"} {
+		start := time.Now()
+		content, _ := client.executeCode(t, code)
+		if status := getString(t, "content", content, "status"); status != "error" {
+			t.Fatalf("\t%s Expected %q to time out", failure, code)
+		}
+		if evalue := getString(t, "content", content, "evalue"); !strings.Contains(evalue, ErrCellTimeout.Error()) {
+			t.Fatalf("\t%s Unexpected error of %q: %q", failure, code, evalue)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Fatalf("\t%s %q was not stopped, it took %v", failure, code, elapsed)
+		}
+	}
+
+	content, _ := client.executeCode(t, "%timeout 0\nsleep(\"500ms\")")
+	if status := getString(t, "content", content, "status"); status != "ok" {
+		t.Fatalf("\t%s Expected %%timeout 0 to remove the timeout", failure)
+	}
+
+	stdout, _ := testOutputStreamFor(t, client, "%timeout\n%timeout 1.5\n%timeout\n%timeout 0\n%timeout")
+	if out := strings.Join(stdout, ""); out != "timeout: 300ms\ntimeout: 1.5s\ntimeout: none\n" {
+		t.Fatalf("\t%s Unexpected output of %%timeout %q", failure, out)
+	}
+
+	content, _ = client.executeCode(t, "%timeout -1s")
+	if status := getString(t, "content", content, "status"); status != "error" {
+		t.Fatalf("\t%s Expected a negative timeout to be refused", failure)
+	}
+	t.Logf("\t%s Cells timed out.", success)
+}
+
+// TestMemoryWarning tests that cells write a warning when the memory of the process gets close to the
+// memory limit.
+func TestMemoryWarning(t *testing.T) {
+	var buf bytes.Buffer
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	watchMemory(ctx, 1<<50, &buf)
+	if buf.Len() != 0 {
+		t.Fatalf("\t%s Unexpected warning %q", failure, buf.String())
+	}
+
+	// The test process always uses more than 1 MiB, even after collections. The limit is
+	// process-wide: restore it for the other tests.
+	previous := debug.SetMemoryLimit(-1)
+	t.Cleanup(func() { debug.SetMemoryLimit(previous) })
+
+	_, client := startTestKernel(t, WithMemoryLimit(1<<20))
+	_, stderr := testOutputStreamFor(t, client, `value("x")`)
+	if out := strings.Join(stderr, ""); !strings.HasPrefix(out, "warning: the kernel uses ") || !strings.Contains(out, "memory limit") {
+		t.Fatalf("\t%s Unexpected warning %q", failure, out)
+	}
+	t.Logf("\t%s The memory limit was set and reported.", success)
+}
@@ -0,0 +1,283 @@
+package jupyter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// VariableLookup may be implemented by an Interpreter to let shell commands refer to its variables.
+// `$` and `!` escapes then replace `{name}` and `$name` by the value of the variable, quoted for the
+// shell. Placeholders that don't name a variable are left unchanged.
+type VariableLookup interface {
+	Lookup(name string) (value any, ok bool)
+}
+
+// VariableAssigner may be implemented by an Interpreter to receive the output of `name = !command`
+// lines as a []string of output lines.
+type VariableAssigner interface {
+	Assign(name string, value any) error
+}
+
+// execute shell command in the working directory of the kernel. line must start with '!', '!!' or '$'
+func (kernel *Kernel) evalShellCommand(ec *ExecutionContext, line string) error {
+	command := strings.TrimSpace(shellEscape.ReplaceAllString(line, ""))
+	if command == "" {
+		return kernel.opts.Policy.checkShell()
+	}
+	argv, err := kernel.escapeArgv(ec, kernel.expandShellVariables(command))
+	if err != nil {
+		return err
+	}
+	return kernel.runArgv(ec, command, argv, nil)
+}
+
+// shellEscape matches the `$`, `!` or `!!` starting a shell command.
+var shellEscape = regexp.MustCompile(`^(\$|!!?)`)
+
+// shellAssignment matches `name = !command` and `name = !!command`, which assign the output of
+// command to an interpreter variable.
+var shellAssignment = regexp.MustCompile(`^([\pL_][\pL\pN_]*)\s*=\s*!!?(.*)$`)
+
+// evalShellAssignment runs the command of a `name = !command` line and assigns its output, split
+// into lines, to the interpreter variable `name` as a []string.
+func (kernel *Kernel) evalShellAssignment(ec *ExecutionContext, line string) error {
+	match := shellAssignment.FindStringSubmatch(line)
+	name, command := match[1], strings.TrimSpace(match[2])
+
+	assigner, ok := kernel.ir.(VariableAssigner)
+	if !ok {
+		return fmt.Errorf("cannot assign the output of a shell command to %s: the interpreter does not support it", name)
+	}
+
+	argv, err := kernel.escapeArgv(ec, kernel.expandShellVariables(command))
+	if err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	if err := kernel.runArgv(ec, command, argv, &out); err != nil {
+		return err
+	}
+
+	output := strings.TrimSuffix(out.String(), "\n")
+	lines := []string{}
+	if output != "" {
+		lines = strings.Split(output, "\n")
+	}
+	return assigner.Assign(name, lines)
+}
+
+// runShell runs script with `shell -c` in the working directory of the kernel, writing its output
+// to the streams of the cell. Further args are passed as positional parameters of the script.
+func (kernel *Kernel) runShell(ec *ExecutionContext, shell, script string, args ...string) error {
+	policy := &kernel.opts.Policy
+	if err := policy.checkShell(); err != nil {
+		return err
+	}
+	if err := policy.checkExecutable(ec.Dir, shell); err != nil {
+		return err
+	}
+	return kernel.runArgv(ec, script, append([]string{shell, "-c", script, shell}, args...), nil)
+}
+
+// escapeArgv returns the command line running a `$` or `!` command. The command runs with
+// `Shell -c`, unless the policy of the kernel restricts the executables: it is then split into
+// words and run directly, without a shell.
+func (kernel *Kernel) escapeArgv(ec *ExecutionContext, command string) ([]string, error) {
+	policy := &kernel.opts.Policy
+	if err := policy.checkShell(); err != nil {
+		return nil, err
+	}
+	if policy.AllowedExecutables == nil {
+		return []string{kernel.opts.Shell, "-c", command}, nil
+	}
+
+	argv, err := splitArgs(command)
+	if err != nil {
+		return nil, err
+	}
+	if len(argv) == 0 {
+		return nil, policyError("empty command")
+	}
+	if err := policy.checkExecutable(ec.Dir, argv[0]); err != nil {
+		return nil, err
+	}
+	return argv, nil
+}
+
+// runArgv runs a command line in the working directory of the kernel, within the timeout and the
+// output limit of the policy. The output goes to the streams of the cell, or the stdout to
+// `capture` if it is not nil. `script` describes the command in errors.
+func (kernel *Kernel) runArgv(ec *ExecutionContext, script string, argv []string, capture io.Writer) error {
+	policy := &kernel.opts.Policy
+
+	ctx, cancel := ec.Context, context.CancelFunc(func() {})
+	if policy.CommandTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, policy.CommandTimeout)
+	}
+	defer cancel()
+
+	stdout, stderr := ec.Stdout, ec.Stderr
+	if capture != nil {
+		stdout = capture
+	}
+	var budget *outputBudget
+	if policy.MaxCommandOutput > 0 {
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		budget = &outputBudget{left: policy.MaxCommandOutput, stop: cancel}
+		stdout = &limitedWriter{stdout, budget}
+		stderr = &limitedWriter{stderr, budget}
+	}
+
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Dir = ec.Dir
+	cmd.Env = ec.Env
+	// Children of a stopped shell may keep its output open: don't wait for them.
+	cmd.WaitDelay = captureDrainTimeout
+
+	var err error
+	if capture != nil {
+		cmd.Stdout, cmd.Stderr = stdout, stderr
+		err = cmd.Run()
+	} else {
+		err = kernel.runCommand(ctx, ec, cmd, stdout, stderr)
+	}
+
+	switch {
+	case budget != nil && budget.exceeded:
+		return policyError("output of shell command %q exceeded %d bytes", shellSummary(script), policy.MaxCommandOutput)
+	case errors.Is(ctx.Err(), context.DeadlineExceeded) && ec.Context.Err() == nil:
+		return policyError("shell command %q timed out after %v", shellSummary(script), policy.CommandTimeout)
+	}
+	return shellError(script, err)
+}
+
+// runCommand runs cmd with its output written to stdout and stderr. If KernelOptions.Pty is set
+// and the platform supports it, the command runs in a pseudo-terminal, whose output goes to
+// stdout. The command reads from an empty stdin, unless KernelOptions.ShellStdin lets it prompt
+// the front-end through the pseudo-terminal.
+func (kernel *Kernel) runCommand(ctx context.Context, ec *ExecutionContext, cmd *exec.Cmd, stdout, stderr io.Writer) error {
+	if kernel.opts.Pty {
+		var input inputFunc
+		if kernel.opts.ShellStdin {
+			input = ec.input
+		}
+		err := runPty(ctx, cmd, kernel.opts.TerminalWidth, stdout, input)
+		if !errors.Is(err, errPtyUnsupported) {
+			return err
+		}
+	}
+
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
+
+// shellError turns the error of running script into the error of the cell.
+func shellError(script string, err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return fmt.Errorf("shell command %q failed: %v", shellSummary(script), exitErr)
+	} else if err != nil {
+		return fmt.Errorf("error running shell command %q: %v", shellSummary(script), err)
+	}
+	return nil
+}
+
+// shellSummary shortens a script to its first line for error messages.
+func shellSummary(script string) string {
+	script = strings.TrimSpace(script)
+	if first, _, multiline := strings.Cut(script, "\n"); multiline {
+		return first + " ..."
+	}
+	return script
+}
+
+// expandShellVariables replaces `{expr}` and `$name` in a shell command by the values the
+// interpreter returns for them, quoted for the shell. `{{`, `}}` and `$$` stand for literal `{`,
+// `}` and `$`. Without a VariableLookup, the command is returned unchanged.
+func (kernel *Kernel) expandShellVariables(command string) string {
+	lookup, ok := kernel.ir.(VariableLookup)
+	if !ok {
+		return command
+	}
+
+	var buf strings.Builder
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case (c == '{' || c == '}' || c == '$') && i+1 < len(command) && command[i+1] == c:
+			buf.WriteByte(c)
+			i++
+		case c == '{':
+			end := strings.IndexByte(command[i+1:], '}')
+			if end < 0 {
+				buf.WriteByte(c)
+				continue
+			}
+			expr := command[i+1 : i+1+end]
+			if value, ok := lookup.Lookup(strings.TrimSpace(expr)); ok {
+				buf.WriteString(shellQuoteValue(value))
+				i += end + 1
+				continue
+			}
+			buf.WriteByte(c)
+		case c == '$' && i+1 < len(command) && command[i+1] == '{':
+			// a shell parameter expansion, ${name}
+			end := strings.IndexByte(command[i:], '}')
+			if end < 0 {
+				end = len(command) - i - 1
+			}
+			buf.WriteString(command[i : i+end+1])
+			i += end
+		case c == '$':
+			end := i + 1
+			for end < len(command) && isShellNameByte(command[end], end == i+1) {
+				end++
+			}
+			if end > i+1 {
+				if value, ok := lookup.Lookup(command[i+1 : end]); ok {
+					buf.WriteString(shellQuoteValue(value))
+					i = end - 1
+					continue
+				}
+			}
+			buf.WriteByte(c)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
+
+// isShellNameByte reports whether c may appear in a `$name` placeholder.
+func isShellNameByte(c byte, first bool) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || !first && '0' <= c && c <= '9'
+}
+
+// shellQuoteValue formats a value as shell words. The elements of a []string become separate
+// words; other values become a single word.
+func shellQuoteValue(value any) string {
+	if values, ok := value.([]string); ok {
+		words := make([]string, len(values))
+		for i, v := range values {
+			words[i] = shellQuote(v)
+		}
+		return strings.Join(words, " ")
+	}
+	return shellQuote(fmt.Sprint(value))
+}
+
+// shellQuote quotes s as a single shell word.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_@%+=:,./-") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,63 @@
+package jupyter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestExpandShellVariables tests the expansion of interpreter variables in shell commands.
+func TestExpandShellVariables(t *testing.T) {
+	kernel := &Kernel{ir: testInterpreter{}}
+
+	tests := map[string]string{
+		`echo {name}`:           `echo 'big world'`,
+		`echo { answer }x`:      `echo 42x`,
+		`echo $answer$name`:     `echo 42'big world'`,
+		`ls {files}`:            `ls 'a b' c`,
+		`echo {{name}} $$name`:  `echo {name} $name`,
+		`echo {a,b} $HOME {`:    `echo {a,b} $HOME {`,
+		`echo ${name} ${HOME}`:  `echo ${name} ${HOME}`,
+		`echo "it's" {unknown}`: `echo "it's" {unknown}`,
+	}
+	for command, want := range tests {
+		if got := kernel.expandShellVariables(command); got != want {
+			t.Fatalf("\t%s expandShellVariables(%q) = %q, want %q", failure, command, got, want)
+		}
+	}
+
+	if got := shellQuote("it's"); got != `'it'\''s'` {
+		t.Fatalf("\t%s Unexpected quoting %q", failure, got)
+	}
+	t.Logf("\t%s Variables were expanded.", success)
+}
+
+// TestShellAssignment tests that `name = !command` and `name = !!command` assign the output lines of command.
+func TestShellAssignment(t *testing.T) {
+	pretty := DefaultPrettyOptions
+	pretty.Color = false
+	_, client := startTestKernel(t, WithPrettyOptions(pretty))
+
+	_, pub := client.executeCode(t, "!echo {name}\nshell_lines = !printf 'x\\ny y\\n'\nvariable(\"shell_lines\")")
+	var stdout strings.Builder
+	for _, pubMsg := range pub {
+		if pubMsg.Header.MsgType == "stream" {
+			stdout.WriteString(getString(t, "content", getMsgContentAsJSONObject(t, pubMsg), "text"))
+		}
+	}
+	if stdout.String() != "big world\n" {
+		t.Fatalf("\t%s Unexpected output %q", failure, stdout.String())
+	}
+	if results := testResults(t, pub); len(results) != 1 || results[0] != `execute_result []string (len 2) {"x", "y y"}` {
+		t.Fatalf("\t%s Unexpected results %q", failure, results)
+	}
+	if value, _ := testVariables.Load("shell_lines"); len(value.([]string)) != 2 {
+		t.Fatalf("\t%s Unexpected value %q", failure, value)
+	}
+
+	client.executeCode(t, "shell_word = !!echo word")
+	if value, _ := testVariables.Load("shell_word"); !reflect.DeepEqual(value, []string{"word"}) {
+		t.Fatalf("\t%s Unexpected value %q", failure, value)
+	}
+	t.Logf("\t%s Shell output was assigned.", success)
+}
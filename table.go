@@ -0,0 +1,406 @@
+package jupyter
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MIMETypeDataResource is the tabular data format of the data grid of JupyterLab, a Frictionless
+// Data resource with a Table Schema.
+const MIMETypeDataResource = "application/vnd.dataresource+json"
+
+// TableOptions bounds the tables displayed for slices of structs, slices of slices and maps
+// returned by cells.
+type TableOptions struct {
+	// MaxRows is the number of rows displayed; the others are counted. Zero disables the limit.
+	MaxRows int
+
+	// MaxColumns is the number of columns displayed; the others are counted. Zero disables the
+	// limit.
+	MaxColumns int
+}
+
+// DefaultTableOptions are the table limits applied to the results of cells unless configured
+// otherwise.
+var DefaultTableOptions = TableOptions{
+	MaxRows:    60,
+	MaxColumns: 20,
+}
+
+// tableCellOptions formats the cells of tables.
+var tableCellOptions = PrettyOptions{MaxDepth: 2, MaxItems: 10, MaxStringLength: 100}
+
+// tableCellLength is the number of runes displayed of a cell.
+const tableCellLength = 200
+
+// tableStyle is the style sheet of the HTML tables.
+const tableStyle = `<style>
+.go-jupyter-table { border-collapse: collapse; font-size: 12px; }
+.go-jupyter-table th, .go-jupyter-table td { padding: 4px 8px; border-bottom: 1px solid #ddd; text-align: left; }
+.go-jupyter-table thead th { border-bottom: 2px solid #999; }
+.go-jupyter-table td.number { text-align: right; font-variant-numeric: tabular-nums; }
+.go-jupyter-table tbody tr:nth-child(even) { background: rgba(0, 0, 0, 0.03); }
+.go-jupyter-table-shape { color: #666; font-size: 12px; }
+</style>
+`
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// tableColumn is a column of a table.
+type tableColumn struct {
+	name string
+
+	// typ is the static type of the cells of the column.
+	typ reflect.Type
+
+	// cell returns the cell of the column in a row.
+	cell func(row reflect.Value) reflect.Value
+}
+
+// table is the tabular form of a value.
+type table struct {
+	// indexName is the name of the column labeling the rows: "index" for the positions in a
+	// slice, "key" for the keys of a map.
+	indexName string
+	indexType reflect.Type
+
+	columns []tableColumn
+
+	// index and rows are the labels and values of the displayed rows.
+	index []reflect.Value
+	rows  []reflect.Value
+
+	// totalRows and totalColumns count all rows and columns, including those not displayed.
+	totalRows, totalColumns int
+}
+
+// renderTable renders slices and arrays of structs, of slices and of arrays, and maps, as an HTML
+// table and a data resource. It reports false for other values.
+func renderTable(value any, opts TableOptions) (Data, bool) {
+	t, ok := newTable(reflect.ValueOf(value), opts)
+	if !ok {
+		return Data{}, false
+	}
+	return Data{Data: MIMEMap{
+		MIMETypeHTML:         t.html(),
+		MIMETypeDataResource: t.dataResource(),
+	}}, true
+}
+
+// newTable returns the tabular form of v, with at most MaxRows rows and MaxColumns columns.
+func newTable(v reflect.Value, opts TableOptions) (*table, bool) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+
+	t := &table{}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		t.indexName, t.indexType = "index", reflect.TypeOf(0)
+		t.totalRows = v.Len()
+		for i := 0; i < limitCount(v.Len(), opts.MaxRows); i++ {
+			t.index = append(t.index, reflect.ValueOf(i))
+			t.rows = append(t.rows, v.Index(i))
+		}
+		elem := v.Type().Elem()
+		switch {
+		case isStructType(elem):
+			t.columns = structColumns(elem)
+		case isListType(elem) && v.Len() > 0:
+			t.columns = listColumns(elem, t.rows)
+		default:
+			return nil, false
+		}
+	case reflect.Map:
+		t.indexName, t.indexType = "key", v.Type().Key()
+		t.totalRows = v.Len()
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return lessKey(keys[i], keys[j]) })
+		for _, key := range keys[:limitCount(len(keys), opts.MaxRows)] {
+			t.index = append(t.index, key)
+			t.rows = append(t.rows, v.MapIndex(key))
+		}
+		if elem := v.Type().Elem(); isStructType(elem) {
+			t.columns = structColumns(elem)
+		} else {
+			t.columns = []tableColumn{{name: "value", typ: elem, cell: func(row reflect.Value) reflect.Value { return row }}}
+		}
+	default:
+		return nil, false
+	}
+
+	if len(t.columns) == 0 {
+		return nil, false
+	}
+	for t.hasColumn(t.indexName) {
+		t.indexName = "_" + t.indexName
+	}
+	t.totalColumns = len(t.columns)
+	t.columns = t.columns[:limitCount(len(t.columns), opts.MaxColumns)]
+	return t, true
+}
+
+// hasColumn reports whether the table has a column `name`.
+func (t *table) hasColumn(name string) bool {
+	for _, c := range t.columns {
+		if c.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// limitCount returns the number of items displayed out of n.
+func limitCount(n, max int) int {
+	if max > 0 && n > max {
+		return max
+	}
+	return n
+}
+
+// isStructType reports whether t is a struct type, or a pointer to one, with exported fields.
+func isStructType(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && t != timeType && len(structColumns(t)) != 0
+}
+
+// isListType reports whether t is a slice or array type, other than []byte.
+func isListType(t reflect.Type) bool {
+	return (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() != reflect.Uint8
+}
+
+// structColumns returns the columns of the exported fields of the struct type t, or of the
+// struct t points to, named by their json tag if they have one.
+func structColumns(t reflect.Type) []tableColumn {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	var columns []tableColumn
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Name
+		if tag, _, _ := strings.Cut(f.Tag.Get("json"), ","); tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+
+		i := i
+		columns = append(columns, tableColumn{
+			name: name,
+			typ:  f.Type,
+			cell: func(row reflect.Value) reflect.Value {
+				row = reflect.Indirect(row)
+				if !row.IsValid() {
+					return reflect.Value{}
+				}
+				return row.Field(i)
+			},
+		})
+	}
+	return columns
+}
+
+// listColumns returns the columns of rows of type t, a slice or array type, as many as the
+// longest row has elements.
+func listColumns(t reflect.Type, rows []reflect.Value) []tableColumn {
+	width := 0
+	for _, row := range rows {
+		width = max(width, row.Len())
+	}
+
+	columns := make([]tableColumn, width)
+	for i := range columns {
+		i := i
+		columns[i] = tableColumn{
+			name: strconv.Itoa(i),
+			typ:  t.Elem(),
+			cell: func(row reflect.Value) reflect.Value {
+				if i >= row.Len() {
+					return reflect.Value{}
+				}
+				return row.Index(i)
+			},
+		}
+	}
+	return columns
+}
+
+// html returns the styled HTML table, followed by the number of rows and columns.
+func (t *table) html() string {
+	var sb strings.Builder
+	sb.WriteString(tableStyle)
+	sb.WriteString(`<table class="go-jupyter-table">` + "\n<thead>\n<tr><th></th>")
+	for _, c := range t.columns {
+		fmt.Fprintf(&sb, "<th>%s</th>", html.EscapeString(c.name))
+	}
+	if t.totalColumns > len(t.columns) {
+		sb.WriteString("<th>…</th>")
+	}
+	sb.WriteString("</tr>\n</thead>\n<tbody>\n")
+
+	for i, row := range t.rows {
+		fmt.Fprintf(&sb, "<tr><th>%s</th>", html.EscapeString(cellText(t.index[i])))
+		for _, c := range t.columns {
+			class := ""
+			if isNumberType(c.typ) {
+				class = ` class="number"`
+			}
+			fmt.Fprintf(&sb, "<td%s>%s</td>", class, html.EscapeString(cellText(c.cell(row))))
+		}
+		if t.totalColumns > len(t.columns) {
+			sb.WriteString("<td>…</td>")
+		}
+		sb.WriteString("</tr>\n")
+	}
+	if t.totalRows > len(t.rows) {
+		sb.WriteString("<tr><th>…</th>")
+		sb.WriteString(strings.Repeat("<td>…</td>", len(t.columns)))
+		if t.totalColumns > len(t.columns) {
+			sb.WriteString("<td>…</td>")
+		}
+		sb.WriteString("</tr>\n")
+	}
+	sb.WriteString("</tbody>\n</table>\n")
+
+	fmt.Fprintf(&sb, `<p class="go-jupyter-table-shape">%s × %s</p>`,
+		plural(t.totalRows, "1 row", fmt.Sprintf("%d rows", t.totalRows)),
+		plural(t.totalColumns, "1 column", fmt.Sprintf("%d columns", t.totalColumns)))
+	return sb.String()
+}
+
+// dataResource returns the displayed rows as a data resource, keyed by the index column.
+func (t *table) dataResource() map[string]any {
+	fields := []map[string]any{{"name": t.indexName, "type": schemaType(t.indexType)}}
+	for _, c := range t.columns {
+		fields = append(fields, map[string]any{"name": c.name, "type": schemaType(c.typ)})
+	}
+
+	data := make([]map[string]any, len(t.rows))
+	for i, row := range t.rows {
+		record := map[string]any{t.indexName: jsonCell(t.index[i])}
+		for _, c := range t.columns {
+			record[c.name] = jsonCell(c.cell(row))
+		}
+		data[i] = record
+	}
+
+	return map[string]any{
+		"schema": map[string]any{
+			"fields":     fields,
+			"primaryKey": []string{t.indexName},
+		},
+		"data": data,
+	}
+}
+
+// cellText returns the text of a cell of the HTML table.
+func cellText(v reflect.Value) string {
+	if !v.IsValid() {
+		return ""
+	}
+	var text string
+	if v.CanInterface() {
+		text = tableCellOptions.Format(v.Interface())
+	} else {
+		text = fmt.Sprint(v)
+	}
+	if utf8.RuneCountInString(text) > tableCellLength {
+		text = string([]rune(text)[:tableCellLength]) + "…"
+	}
+	return text
+}
+
+// hasText reports whether the values of type t are displayed by their String or Error method.
+func hasText(t reflect.Type) bool {
+	return t != timeType && (t.Implements(stringerType) || t.Implements(errorType))
+}
+
+// isNumberType reports whether the cells of type t are numbers.
+func isNumberType(t reflect.Type) bool {
+	switch schemaType(t) {
+	case "integer", "number":
+		return true
+	}
+	return false
+}
+
+// schemaType returns the Table Schema type of the cells of type t.
+func schemaType(t reflect.Type) string {
+	switch {
+	case t == timeType:
+		return "datetime"
+	case hasText(t):
+		return "string"
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Interface:
+		return "any"
+	}
+	return "string"
+}
+
+// jsonCell returns the value of a cell in the data resource: numbers, booleans and strings as is,
+// times in RFC 3339 format and other values as the text of the HTML table.
+func jsonCell(v reflect.Value) any {
+	for v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil
+	}
+
+	t := v.Type()
+	switch {
+	case t == timeType && v.CanInterface():
+		return v.Interface().(time.Time).Format(time.RFC3339Nano)
+	case hasText(t):
+		return cellText(v)
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint()
+	case reflect.Float32, reflect.Float64:
+		if f := v.Float(); !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return f
+		}
+		return nil
+	case reflect.String:
+		return v.String()
+	}
+	return cellText(v)
+}
@@ -0,0 +1,125 @@
+package jupyter
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testRow struct {
+	ID      int     `json:"id"`
+	Product string  `json:"product,omitempty"`
+	Price   float64 // no tag
+	Secret  string  `json:"-"`
+	hidden  bool
+	When    time.Time
+}
+
+// TestRenderTable tests that a slice of structs is rendered as an HTML table and a tabular data
+// resource, with the field names of its JSON tags and empty cells for nil rows.
+func TestRenderTable(t *testing.T) {
+	when := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	rows := []*testRow{
+		{ID: 1, Product: "<tea>", Price: 2.5, When: when},
+		nil,
+		{ID: 3, Product: "cake", Price: math.NaN()},
+	}
+
+	data, ok := renderTable(rows, DefaultTableOptions)
+	if !ok {
+		t.Fatalf("\t%s Expected a slice of structs to render as a table", failure)
+	}
+	html := data.Data[MIMETypeHTML].(string)
+	for _, want := range []string{
+		"<th></th><th>id</th><th>product</th><th>Price</th><th>When</th></tr>",
+		`<tr><th>0</th><td class="number">1</td><td>&lt;tea&gt;</td><td class="number">2.5</td><td>2024-05-01 12:00:00 +0000 UTC</td></tr>`,
+		`<tr><th>1</th><td class="number"></td><td></td><td class="number"></td><td></td></tr>`,
+		"3 rows × 4 columns",
+	} {
+		if !strings.Contains(html, want) {
+			t.Fatalf("\t%s Expected %q in the table\n%s", failure, want, html)
+		}
+	}
+
+	encoded, err := json.Marshal(data.Data[MIMETypeDataResource])
+	if err != nil {
+		t.Fatalf("\t%s Encoding the data resource: %v", failure, err)
+	}
+	want := `{"data":[` +
+		`{"Price":2.5,"When":"2024-05-01T12:00:00Z","id":1,"index":0,"product":"\u003ctea\u003e"},` +
+		`{"Price":null,"When":null,"id":null,"index":1,"product":null},` +
+		`{"Price":null,"When":"0001-01-01T00:00:00Z","id":3,"index":2,"product":"cake"}],` +
+		`"schema":{"fields":[{"name":"index","type":"integer"},{"name":"id","type":"integer"},{"name":"product","type":"string"},` +
+		`{"name":"Price","type":"number"},{"name":"When","type":"datetime"}],"primaryKey":["index"]}}`
+	if string(encoded) != want {
+		t.Fatalf("\t%s Unexpected data resource\n%s\nwant\n%s", failure, encoded, want)
+	}
+	kernel := &Kernel{opts: defaultKernelOptions(), renderers: NewRendererRegistry()}
+	result := kernel.renderResult(rows)
+	for _, mimeType := range []string{MIMETypeText, MIMETypeHTML, MIMETypeDataResource} {
+		if _, ok := result.Data[mimeType]; !ok {
+			t.Fatalf("\t%s Expected a %s representation of the result", failure, mimeType)
+		}
+	}
+	t.Logf("\t%s A slice of structs was rendered as a table.", success)
+}
+
+// TestRenderTableShapes tests that slices of slices and maps are rendered as truncated tables, and that
+// values which are not tabular are not.
+func TestRenderTableShapes(t *testing.T) {
+	opts := TableOptions{MaxRows: 2, MaxColumns: 2}
+
+	cases := []struct {
+		value any
+		want  []string
+	}{
+		{[][]int{{1, 2, 3}, {4}, {5}}, []string{
+			"<th></th><th>0</th><th>1</th><th>…</th></tr>",
+			`<tr><th>1</th><td class="number">4</td><td class="number"></td><td>…</td></tr>`,
+			"<tr><th>…</th><td>…</td><td>…</td><td>…</td></tr>",
+			"3 rows × 3 columns",
+		}},
+		{map[string]float64{"b": 2, "a": 1}, []string{
+			"<th></th><th>value</th></tr>",
+			`<tr><th>a</th><td class="number">1</td></tr>`,
+			"2 rows × 1 column",
+		}},
+		{map[int]testRow{7: {ID: 7}}, []string{
+			`<tr><th>7</th><td class="number">7</td><td></td><td>…</td></tr>`,
+			"1 row × 4 columns",
+		}},
+	}
+	for _, c := range cases {
+		data, ok := renderTable(c.value, opts)
+		if !ok {
+			t.Fatalf("\t%s Expected %T to render as a table", failure, c.value)
+		}
+		html := data.Data[MIMETypeHTML].(string)
+		for _, want := range c.want {
+			if !strings.Contains(html, want) {
+				t.Fatalf("\t%s Expected %q in the table of %T\n%s", failure, want, c.value, html)
+			}
+		}
+	}
+
+	resource := func(value any) map[string]any {
+		data, _ := renderTable(value, opts)
+		return data.Data[MIMETypeDataResource].(map[string]any)
+	}
+	if keys := resource(map[string]float64{"b": 2, "a": 1})["schema"].(map[string]any)["primaryKey"]; !reflect.DeepEqual(keys, []string{"key"}) {
+		t.Fatalf("\t%s Unexpected primary key %v", failure, keys)
+	}
+	if rows := resource([][]int{{1, 2, 3}, {4}, {5}})["data"].([]map[string]any); len(rows) != 2 || len(rows[0]) != 3 {
+		t.Fatalf("\t%s Unexpected truncated data %v", failure, rows)
+	}
+
+	for _, value := range []any{[]int{1, 2}, []time.Time{{}}, [][]byte{[]byte("x")}, "text", [][]int{}, []struct{ x int }{{1}}} {
+		if _, ok := renderTable(value, opts); ok {
+			t.Fatalf("\t%s Expected %T not to render as a table", failure, value)
+		}
+	}
+	t.Logf("\t%s Tables were rendered and truncated.", success)
+}